@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/host"
+)
+
+// maxRecentChanges is the number of changes inventory keeps for /changes.
+const maxRecentChanges = 100
+
+// inventory holds the hosts last applied to the hosts file and the changes
+// recently made to it, and serves them as a read-only JSON API. A nil
+// *inventory discards syncs, like metrics.
+type inventory struct {
+	mu        sync.Mutex
+	hosts     []apiHost
+	byName    map[string]apiHost
+	changes   []apiChange
+	updated   time.Time
+	lastSeen  map[string]time.Time
+	providers map[string]*providerHealth
+}
+
+// providerHealth is the outcome of the latest attempts at getting the hosts
+// of a provider.
+type providerHealth struct {
+	LastAttempt time.Time
+	LastSuccess time.Time
+	// LastError is the error of the last attempt, empty if it succeeded.
+	LastError string
+	Latency   time.Duration
+}
+
+// apiHost is the JSON form of a host served by /hosts.
+type apiHost struct {
+	Hostname string `json:"hostname"`
+	IP       string `json:"ip"`
+	MAC      string `json:"mac,omitempty"`
+	Static   bool   `json:"static"`
+	Provider string `json:"provider,omitempty"`
+	// LastSeen is when the provider last reported the host, rather than
+	// it being served from the cache.
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// apiChange is the JSON form of a change served by /changes, the event
+// emitted by -output-events along with when the change was made.
+type apiChange struct {
+	Time time.Time `json:"time"`
+	changeEvent
+}
+
+func newInventory() *inventory {
+	return &inventory{
+		byName:    map[string]apiHost{},
+		lastSeen:  map[string]time.Time{},
+		providers: map[string]*providerHealth{},
+	}
+}
+
+// providerFetched records an attempt at fetching the hosts of a provider.
+func (inv *inventory) providerFetched(provider string, duration time.Duration, err error) {
+	if inv == nil {
+		return
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	health := inv.health(provider)
+	health.LastAttempt = time.Now()
+	health.Latency = duration
+	health.LastError = ""
+	if err != nil {
+		health.LastError = err.Error()
+		return
+	}
+	health.LastSuccess = health.LastAttempt
+}
+
+// providerFailed records a provider failing outside of a fetch, such as when
+// logging in.
+func (inv *inventory) providerFailed(provider string, err error) {
+	if inv == nil {
+		return
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	health := inv.health(provider)
+	health.LastAttempt = time.Now()
+	health.LastError = err.Error()
+}
+
+func (inv *inventory) health(provider string) *providerHealth {
+	health, ok := inv.providers[provider]
+	if !ok {
+		health = &providerHealth{}
+		inv.providers[provider] = health
+	}
+
+	return health
+}
+
+// synced records the hosts applied by a sync at t and the changes it made.
+// Hosts are only seen at t if their provider's last fetch succeeded.
+func (inv *inventory) synced(hosts []host.Host, changes host.ChangeSet, t time.Time) {
+	if inv == nil {
+		return
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	current := make([]apiHost, 0, len(hosts))
+	byName := make(map[string]apiHost, len(hosts))
+	for _, h := range hosts {
+		key := strings.ToLower(h.Name)
+		if health, ok := inv.providers[h.Provider]; !ok || health.LastError == "" {
+			inv.lastSeen[key] = t
+		}
+
+		a := apiHost{
+			Hostname: h.Name,
+			IP:       h.IP.String(),
+			MAC:      h.MAC,
+			Static:   h.Static,
+			Provider: h.Provider,
+			LastSeen: inv.lastSeen[key],
+		}
+		current = append(current, a)
+		byName[key] = a
+	}
+	sort.Slice(current, func(i, j int) bool {
+		return current[i].Hostname < current[j].Hostname
+	})
+	for key := range inv.lastSeen {
+		if _, ok := byName[key]; !ok {
+			delete(inv.lastSeen, key)
+		}
+	}
+
+	inv.updated = t
+	inv.hosts = current
+	inv.byName = byName
+	for _, change := range changes.Changes {
+		inv.changes = append(inv.changes, apiChange{Time: t, changeEvent: newChangeEvent(change)})
+	}
+	if len(inv.changes) > maxRecentChanges {
+		inv.changes = append([]apiChange(nil), inv.changes[len(inv.changes)-maxRecentChanges:]...)
+	}
+}
+
+// register serves the API on mux: GET /hosts lists the hosts sorted by name,
+// GET /hosts/{name} returns one of them, and GET /changes lists the recent
+// changes, newest first.
+func (inv *inventory) register(mux *http.ServeMux) {
+	mux.HandleFunc("/hosts", inv.serveHosts)
+	mux.HandleFunc("/hosts/", inv.serveHost)
+	mux.HandleFunc("/changes", inv.serveChanges)
+}
+
+func (inv *inventory) serveHosts(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	inv.mu.Lock()
+	hosts := inv.hosts
+	inv.mu.Unlock()
+
+	if hosts == nil {
+		hosts = []apiHost{}
+	}
+	writeJSON(w, http.StatusOK, hosts)
+}
+
+func (inv *inventory) serveHost(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	name := strings.TrimPrefix(r.URL.Path, "/hosts/")
+	inv.mu.Lock()
+	h, ok := inv.byName[strings.ToLower(name)]
+	inv.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "no host named " + name})
+		return
+	}
+	writeJSON(w, http.StatusOK, h)
+}
+
+func (inv *inventory) serveChanges(w http.ResponseWriter, r *http.Request) {
+	if !allowGet(w, r) {
+		return
+	}
+
+	inv.mu.Lock()
+	changes := inv.recentChanges()
+	inv.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, changes)
+}
+
+// recentChanges returns the changes kept, newest first. The caller must hold
+// mu.
+func (inv *inventory) recentChanges() []apiChange {
+	changes := make([]apiChange, 0, len(inv.changes))
+	for i := len(inv.changes) - 1; i >= 0; i-- {
+		changes = append(changes, inv.changes[i])
+	}
+
+	return changes
+}
+
+// allowGet answers requests other than GET and HEAD with an error, returning
+// whether the request should be served.
+func allowGet(w http.ResponseWriter, r *http.Request) bool {
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return true
+	}
+
+	w.Header().Set("Allow", "GET, HEAD")
+	writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/host"
+)
+
+// runApply runs the apply command, the privileged end of -write-helper. It
+// applies the hosts read as JSON on stdin to the hosts file and prints the
+// changes made as JSON on stdout, without talking to the network or knowing
+// the provider credentials.
+func runApply() int {
+	f := &host.HostsFile{Path: hostsPath(), BackupRetention: *backupRetention}
+
+	err := f.Preflight()
+	if err == nil && containerChecks() {
+		err = checkContainerHostsFile(f.Path)
+	}
+	if err != nil {
+		errorLog.Printf("hosts file check failed: %v", err)
+		return exitHostsFileError
+	}
+
+	ctx := context.Background()
+	changes, err := host.ServeHelper(ctx, os.Stdin, os.Stdout, f, func(h host.Host, reason string) {
+		warnLog.Printf("skipping host %q with IP %v and MAC %q: %s", h.Name, h.IP, h.MAC, reason)
+	})
+	if err != nil {
+		errorLog.Printf("could not apply hosts: %v", err)
+		return exitHostsFileError
+	}
+
+	// Stdout carries the changes back to the write helper.
+	if !changes.Empty() {
+		runPostWriteHooks(ctx, changes, os.Stderr)
+	}
+
+	return exitOK
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/host"
+)
+
+// auditRecord is a line of the -audit-log, describing a single change written
+// to the hosts file.
+type auditRecord struct {
+	Time     time.Time   `json:"time"`
+	Action   host.Action `json:"action"`
+	Provider string      `json:"provider,omitempty"`
+	Hostname string      `json:"hostname"`
+	OldIP    string      `json:"old_ip,omitempty"`
+	NewIP    string      `json:"new_ip,omitempty"`
+}
+
+// appendAuditLog appends a JSON line for each change to the audit log at
+// path, creating it if needed. Removals have no new IP and additions no old
+// one.
+func appendAuditLog(path string, changes host.ChangeSet, now time.Time) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	for _, change := range changes.Changes {
+		record := auditRecord{
+			Time:     now,
+			Action:   change.Action,
+			Provider: change.Host.Provider,
+			Hostname: change.Host.Name,
+		}
+
+		switch change.Action {
+		case host.ActionRemove:
+			record.OldIP = change.Host.IP.String()
+		case host.ActionUpdate:
+			record.OldIP = change.OldIP.String()
+			record.NewIP = change.Host.IP.String()
+		default:
+			record.NewIP = change.Host.IP.String()
+		}
+
+		err = enc.Encode(record)
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	return f.Close()
+}
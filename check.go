@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/provider"
+)
+
+// runCheck logs in to each active provider and performs a lightweight API
+// call, reporting reachability, authentication, and latency without touching
+// the hosts file.
+func runCheck(active map[string]map[string]string, opts []provider.Option) int {
+	code := exitOK
+	for _, name := range sortedProviderNames(active) {
+		start := time.Now()
+		p, err := provider.New(name, active[name], opts...)
+		loginLatency := time.Since(start)
+		if errors.Is(err, provider.ErrAuthFailed) {
+			fmt.Printf("%s: reachable=yes auth=failed login=%v error=%q\n", name, loginLatency.Round(time.Millisecond), err)
+			code = exitProviderError
+			continue
+		}
+		if err != nil {
+			fmt.Printf("%s: reachable=no error=%q\n", name, err)
+			code = exitProviderError
+			continue
+		}
+
+		start = time.Now()
+		err = p.Check(context.Background())
+		apiLatency := time.Since(start)
+		var netErr net.Error
+		switch {
+		case errors.Is(err, provider.ErrAuthFailed):
+			fmt.Printf("%s: reachable=yes auth=failed login=%v api=%v error=%q\n",
+				name, loginLatency.Round(time.Millisecond), apiLatency.Round(time.Millisecond), err)
+		case errors.As(err, &netErr):
+			fmt.Printf("%s: reachable=no login=%v error=%q\n", name, loginLatency.Round(time.Millisecond), err)
+		case err != nil:
+			fmt.Printf("%s: reachable=yes auth=ok login=%v api=failed error=%q\n", name, loginLatency.Round(time.Millisecond), err)
+		}
+		if err != nil {
+			code = exitProviderError
+			continue
+		}
+
+		if *quiet {
+			continue
+		}
+
+		fmt.Printf("%s: reachable=yes auth=ok login=%v api=%v\n",
+			name, loginLatency.Round(time.Millisecond), apiLatency.Round(time.Millisecond))
+	}
+
+	return code
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Container modes of the -container flag.
+const (
+	containerAuto = "auto"
+	containerOn   = "on"
+	containerOff  = "off"
+)
+
+// containerHint says how to give the updater the host's hosts file when it
+// runs in a container.
+const containerHint = "bind mount the host's hosts file into the container, e.g. with docker run -v /etc/hosts:/host/etc/hosts, and pass -hosts-file /host/etc/hosts"
+
+// containerChecks reports whether -container asks for the hosts files to be
+// checked.
+func containerChecks() bool {
+	return *container == containerOn || (*container == containerAuto && inContainer())
+}
+
+// inContainer reports whether the updater runs in a Docker, Podman, or
+// Kubernetes container, or any container runtime setting $container.
+func inContainer() bool {
+	for _, marker := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(marker); err == nil {
+			return true
+		}
+	}
+
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != "" || os.Getenv("container") != ""
+}
+
+// checkContainerHostsFile returns an error if the hosts file at path is not
+// one the host can see: either the container's own hosts file, which the
+// container runtime generates and may rewrite, or a file on the container's
+// filesystem, which is discarded with the container.
+func checkContainerHostsFile(path string) error {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+
+	m, err := mountOf(resolved)
+	if err != nil {
+		return fmt.Errorf("could not tell where %s is mounted from: %v", path, err)
+	}
+
+	switch {
+	case m.point == "/":
+		return fmt.Errorf("%s is on the container's own filesystem and any change to it is lost with the container; %s", path, containerHint)
+	case m.point == resolved && runtimeHostsFile(m.root):
+		return fmt.Errorf("%s is the container's own hosts file, managed by the container runtime; %s", path, containerHint)
+	}
+
+	return nil
+}
+
+// runtimeHostsFile reports whether root, the source of a file mount, is a
+// hosts file generated by Docker, Podman, or the kubelet for a container.
+func runtimeHostsFile(root string) bool {
+	switch {
+	case strings.HasSuffix(root, "/etc-hosts") && strings.Contains(root, "/pods/"):
+		return true
+	case strings.HasSuffix(root, "/hosts") && strings.Contains(root, "/containers/"):
+		return true
+	case strings.HasSuffix(root, "/userdata/hosts"):
+		return true
+	}
+
+	return false
+}
+
+// mount is a line of /proc/self/mountinfo.
+type mount struct {
+	// root is the path mounted, within the mounted filesystem.
+	root string
+	// point is where root is mounted.
+	point string
+}
+
+// mountOf returns the mount holding the file at path, which must be free of
+// symlinks.
+func mountOf(path string) (mount, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return mount{}, err
+	}
+	defer f.Close()
+
+	var found mount
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		m := mount{root: unescapeMountinfo(fields[3]), point: unescapeMountinfo(fields[4])}
+
+		// Later mounts over the same point hide earlier ones, so the
+		// longest match seen last wins.
+		if within(path, m.point) && len(m.point) >= len(found.point) {
+			found = m
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return mount{}, err
+	}
+	if found.point == "" {
+		return mount{}, fmt.Errorf("no mount holds %s", path)
+	}
+
+	return found, nil
+}
+
+// within reports whether path is dir or below it.
+func within(path, dir string) bool {
+	return dir == "/" || path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+// unescapeMountinfo decodes the octal escapes, such as \040 for a space, that
+// /proc/self/mountinfo uses in paths.
+func unescapeMountinfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && isOctal(s[i+1]) && isOctal(s[i+2]) && isOctal(s[i+3]) {
+			sb.WriteByte((s[i+1]-'0')<<6 | (s[i+2]-'0')<<3 | (s[i+3] - '0'))
+			i += 3
+			continue
+		}
+		sb.WriteByte(s[i])
+	}
+
+	return sb.String()
+}
+
+func isOctal(c byte) bool {
+	return c >= '0' && c <= '7'
+}
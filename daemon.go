@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runDaemon syncs every interval until interrupted, checking the hosts file
+// for drift every driftInterval in between if it is not zero, and serving
+// metrics and the inventory API, and the dashboard if asked to, on the listen
+// address if one is given. A sync can also be triggered
+// by SIGHUP or by a POST to /sync on the listen address. It runs once no
+// trigger arrived for debounce, but no later than maxWait after the first
+// trigger if that is not zero, so that a burst of triggers causes a single
+// sync. It only returns early for errors that no later sync can fix.
+func runDaemon(s *syncer, interval, driftInterval, debounce, maxWait time.Duration, listen string, dashboard bool) int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		log.Printf("received %v, shutting down", sig)
+		cancel()
+	}()
+
+	// triggers is buffered so that triggering never blocks. Triggers that do
+	// not fit would be coalesced with those pending anyway.
+	triggers := make(chan string, 64)
+	trigger := func(source string) {
+		select {
+		case triggers <- source:
+		default:
+		}
+	}
+
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+	go func() {
+		for range hangups {
+			trigger("SIGHUP")
+		}
+	}()
+
+	if listen != "" {
+		s.metrics = newMetrics()
+		s.inventory = newInventory()
+		s.updater.OnProviderFetched = func(provider string, duration time.Duration, err error) {
+			s.metrics.providerFetched(provider, duration, err)
+			s.inventory.providerFetched(provider, duration, err)
+		}
+		s.trackDesired()
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", s.metrics)
+		s.inventory.register(mux)
+		if dashboard {
+			mux.HandleFunc("/", s.inventory.serveDashboard)
+		}
+		mux.HandleFunc("/sync", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.Header().Set("Allow", http.MethodPost)
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			trigger("POST /sync")
+			w.WriteHeader(http.StatusAccepted)
+		})
+
+		ln, err := net.Listen("tcp", listen)
+		if err != nil {
+			errorLog.Printf("could not listen on %s: %v", listen, err)
+			return exitUsage
+		}
+
+		server := &http.Server{Handler: mux}
+		go server.Serve(ln)
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(shutdownCtx)
+		}()
+
+		if dashboard {
+			log.Printf("serving the dashboard on http://%s/", ln.Addr())
+		} else {
+			log.Printf("serving metrics and the API on http://%s", ln.Addr())
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var driftChecks <-chan time.Time
+	if driftInterval > 0 {
+		s.trackDesired()
+		driftTicker := time.NewTicker(driftInterval)
+		defer driftTicker.Stop()
+		driftChecks = driftTicker.C
+	}
+
+	bursts := newDebouncer(debounce, maxWait)
+	defer bursts.stop()
+
+	for {
+		if s.sync(ctx) == exitUsage {
+			return exitUsage
+		}
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return exitOK
+			case <-driftChecks:
+				s.checkDrift(ctx)
+			case source := <-triggers:
+				if bursts.pending == 0 {
+					log.Printf("update triggered by %s, running once triggers stop for %v", source, debounce)
+				}
+				bursts.trigger(time.Now())
+			case <-bursts.timer.C:
+				if n := bursts.fire(); n > 1 {
+					log.Printf("running update for %d coalesced triggers", n)
+				}
+				break wait
+			case <-ticker.C:
+				// The scheduled sync covers the pending triggers.
+				bursts.stop()
+				break wait
+			}
+		}
+	}
+}
+
+// debouncer coalesces a burst of triggers into one. Its timer fires once no
+// trigger arrived for debounce, or maxWait after the first trigger of the
+// burst if that is not zero, so that steady triggers cannot hold off the
+// update forever.
+type debouncer struct {
+	debounce time.Duration
+	maxWait  time.Duration
+	timer    *time.Timer
+
+	// pending counts the triggers of the current burst, which started at
+	// first. The timer runs while it is not zero.
+	pending int
+	first   time.Time
+}
+
+func newDebouncer(debounce, maxWait time.Duration) *debouncer {
+	d := &debouncer{debounce: debounce, maxWait: maxWait, timer: time.NewTimer(debounce)}
+	d.stopTimer()
+
+	return d
+}
+
+// trigger adds a trigger received at now to the burst and restarts the timer.
+func (d *debouncer) trigger(now time.Time) {
+	if d.pending == 0 {
+		d.first = now
+	}
+	d.pending++
+
+	wait := d.debounce
+	if d.maxWait > 0 {
+		if left := d.first.Add(d.maxWait).Sub(now); left < wait {
+			wait = left
+		}
+	}
+
+	d.stopTimer()
+	d.timer.Reset(wait)
+}
+
+// fire ends the burst once the timer fired, returning its number of triggers.
+func (d *debouncer) fire() int {
+	n := d.pending
+	d.pending = 0
+
+	return n
+}
+
+// stop drops the current burst, if any.
+func (d *debouncer) stop() {
+	d.stopTimer()
+	d.pending = 0
+}
+
+// stopTimer stops the timer and drains its channel, so that a later Reset
+// never sees a stale fire.
+func (d *debouncer) stopTimer() {
+	if !d.timer.Stop() {
+		select {
+		case <-d.timer.C:
+		default:
+		}
+	}
+}
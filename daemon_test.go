@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDebouncerWaitsForQuiet(t *testing.T) {
+	const debounce = 200 * time.Millisecond
+	d := newDebouncer(debounce, 0)
+	defer d.stop()
+
+	// Triggers spaced just under the debounce interval keep delaying the
+	// update until they stop.
+	for i := 0; i < 4; i++ {
+		select {
+		case <-d.timer.C:
+			t.Fatalf("fired before trigger %d, %v after the previous one", i+1, debounce*3/4)
+		default:
+		}
+		d.trigger(time.Now())
+		time.Sleep(debounce * 3 / 4)
+	}
+
+	<-d.timer.C
+	if n := d.fire(); n != 4 {
+		t.Errorf("fire() = %d triggers, want 4", n)
+	}
+}
+
+func TestDebouncerMaxWait(t *testing.T) {
+	const (
+		debounce = 200 * time.Millisecond
+		maxWait  = 300 * time.Millisecond
+	)
+	d := newDebouncer(debounce, maxWait)
+	defer d.stop()
+
+	start := time.Now()
+	d.trigger(start)
+	time.Sleep(debounce * 3 / 4)
+	d.trigger(time.Now())
+
+	<-d.timer.C
+	elapsed := time.Since(start)
+	if elapsed < maxWait || elapsed >= debounce*3/4+debounce {
+		t.Errorf("fired %v after the first trigger, want %v", elapsed, maxWait)
+	}
+	if n := d.fire(); n != 2 {
+		t.Errorf("fire() = %d triggers, want 2", n)
+	}
+
+	// The next burst waits for the debounce interval again.
+	start = time.Now()
+	d.trigger(start)
+	<-d.timer.C
+	if elapsed := time.Since(start); elapsed < debounce {
+		t.Errorf("next burst fired after %v, want %v", elapsed, debounce)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// dashboardRefresh is how often the dashboard page reloads itself.
+const dashboardRefresh = 30 * time.Second
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"ago": ago,
+	"ms": func(d time.Duration) string {
+		return d.Round(time.Millisecond).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>dhcp-hosts-updater</title>
+<style>
+body { font-family: system-ui, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; }
+h2 { font-size: 1.1em; margin-top: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: .3em .8em; border-bottom: 1px solid #ddd; }
+th { background: #f4f4f4; }
+td.mono { font-family: ui-monospace, monospace; }
+.ok { color: #18794e; }
+.failing { color: #c62828; }
+.add { color: #18794e; }
+.update { color: #b26a00; }
+.remove { color: #c62828; }
+.muted { color: #777; }
+</style>
+</head>
+<body>
+<h1>dhcp-hosts-updater</h1>
+<p class="muted">{{len .Hosts}} hosts, updated {{ago .Now .Updated}}</p>
+
+<h2>Providers</h2>
+<table>
+<tr><th>Provider</th><th>Status</th><th>Hosts</th><th>Last success</th><th>Latency</th><th>Error</th></tr>
+{{- range .Providers}}
+<tr>
+<td>{{.Name}}</td>
+{{- if .LastError}}
+<td class="failing">failing</td>
+{{- else}}
+<td class="ok">ok</td>
+{{- end}}
+<td>{{.Hosts}}</td>
+<td>{{ago $.Now .LastSuccess}}</td>
+<td>{{ms .Latency}}</td>
+<td>{{.LastError}}</td>
+</tr>
+{{- else}}
+<tr><td colspan="6" class="muted">No provider was queried yet.</td></tr>
+{{- end}}
+</table>
+
+<h2>Hosts</h2>
+<table>
+<tr><th>Hostname</th><th>IP</th><th>MAC</th><th>Provider</th><th>Lease</th><th>Last seen</th></tr>
+{{- range .Hosts}}
+<tr>
+<td>{{.Hostname}}</td>
+<td class="mono">{{.IP}}</td>
+<td class="mono">{{.MAC}}</td>
+<td>{{.Provider}}</td>
+<td>{{if .Static}}static{{else}}dynamic{{end}}</td>
+<td>{{ago $.Now .LastSeen}}</td>
+</tr>
+{{- else}}
+<tr><td colspan="6" class="muted">No hosts yet.</td></tr>
+{{- end}}
+</table>
+
+<h2>Recent changes</h2>
+<table>
+<tr><th>Time</th><th>Action</th><th>Hostname</th><th>IP</th><th>Old IP</th></tr>
+{{- range .Changes}}
+<tr>
+<td>{{.Time.Format "2006-01-02 15:04:05"}}</td>
+<td class="{{.Action}}">{{.Action}}</td>
+<td>{{.Hostname}}</td>
+<td class="mono">{{.IP}}</td>
+<td class="mono">{{.OldIP}}</td>
+</tr>
+{{- else}}
+<tr><td colspan="5" class="muted">No changes yet.</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// dashboardProvider is a row of the dashboard's provider table.
+type dashboardProvider struct {
+	Name  string
+	Hosts int
+	providerHealth
+}
+
+// serveDashboard renders the inventory, recent changes, and provider health
+// as a web page. It is only served at /, the other paths are not found.
+func (inv *inventory) serveDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if !allowGet(w, r) {
+		return
+	}
+
+	inv.mu.Lock()
+	hostCount := map[string]int{}
+	for _, h := range inv.hosts {
+		hostCount[h.Provider]++
+	}
+	providers := make([]dashboardProvider, 0, len(inv.providers))
+	for name, health := range inv.providers {
+		providers = append(providers, dashboardProvider{Name: name, Hosts: hostCount[name], providerHealth: *health})
+	}
+	data := struct {
+		Now       time.Time
+		Updated   time.Time
+		Refresh   int
+		Hosts     []apiHost
+		Providers []dashboardProvider
+		Changes   []apiChange
+	}{
+		Now:       time.Now(),
+		Updated:   inv.updated,
+		Refresh:   int(dashboardRefresh / time.Second),
+		Hosts:     inv.hosts,
+		Providers: providers,
+		Changes:   inv.recentChanges(),
+	}
+	inv.mu.Unlock()
+
+	sort.Slice(data.Providers, func(i, j int) bool {
+		return data.Providers[i].Name < data.Providers[j].Name
+	})
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := dashboardTemplate.Execute(w, data)
+	if err != nil {
+		errorLog.Printf("could not render dashboard: %v", err)
+	}
+}
+
+// ago describes how long before now t was, e.g. "3m ago", or "never" for
+// the zero time.
+func ago(now, t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+
+	d := now.Sub(t)
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds ago", int(d/time.Second))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/host"
+)
+
+const (
+	colorRed   = "\x1b[31m"
+	colorGreen = "\x1b[32m"
+	colorReset = "\x1b[0m"
+)
+
+// printDiff writes changes to w as diff style lines, removals prefixed with
+// "-" and additions with "+". Updates are shown as a removal of the old entry
+// followed by an addition of the new one. When color is true removals are
+// printed in red and additions in green.
+func printDiff(w io.Writer, changes host.ChangeSet, color bool) {
+	sorted := make([]host.Change, len(changes.Changes))
+	copy(sorted, changes.Changes)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Host.Name < sorted[j].Host.Name
+	})
+
+	for _, change := range sorted {
+		switch change.Action {
+		case host.ActionAdd:
+			printDiffLine(w, "+", colorGreen, change.Host.IP, change.Host.Name, color)
+		case host.ActionRemove:
+			printDiffLine(w, "-", colorRed, change.Host.IP, change.Host.Name, color)
+		case host.ActionUpdate:
+			printDiffLine(w, "-", colorRed, change.OldIP, change.Host.Name, color)
+			printDiffLine(w, "+", colorGreen, change.Host.IP, change.Host.Name, color)
+		}
+	}
+}
+
+func printDiffLine(w io.Writer, prefix, colorCode string, ip net.IP, domain string, color bool) {
+	if color {
+		fmt.Fprintf(w, "%s%s %s %s%s\n", colorCode, prefix, ip, domain, colorReset)
+		return
+	}
+
+	fmt.Fprintf(w, "%s %s %s\n", prefix, ip, domain)
+}
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
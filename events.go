@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/host"
+	"github.com/grounded042/dhcp-hosts-updater/pkg/state"
+)
+
+// actionNewDevice is the action of the event emitted for a device seen for
+// the first time.
+const actionNewDevice host.Action = "new_device"
+
+// actionDrift is the action of the event emitted for a managed entry found
+// changed in the hosts file by a drift check.
+const actionDrift host.Action = "drift"
+
+// changeEvent is the machine readable form of a host.Change, or of a new
+// device, emitted by -output-events.
+type changeEvent struct {
+	Action   host.Action `json:"action"`
+	Hostname string      `json:"hostname"`
+	IP       string      `json:"ip"`
+	OldIP    string      `json:"old_ip,omitempty"`
+	MAC      string      `json:"mac,omitempty"`
+	// Repair is the change the next sync will make to undo drift.
+	Repair host.Action `json:"repair,omitempty"`
+}
+
+// writeEvents writes one JSON object per line to w for each new device and
+// each change.
+func writeEvents(w io.Writer, changes host.ChangeSet, newDevices []state.Device) error {
+	enc := json.NewEncoder(w)
+	for _, d := range newDevices {
+		err := enc.Encode(changeEvent{
+			Action:   actionNewDevice,
+			Hostname: d.Hostname,
+			IP:       d.IP,
+			MAC:      d.MAC,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, change := range changes.Changes {
+		err := enc.Encode(newChangeEvent(change))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newChangeEvent(change host.Change) changeEvent {
+	event := changeEvent{
+		Action:   change.Action,
+		Hostname: change.Host.Name,
+		IP:       change.Host.IP.String(),
+		MAC:      change.Host.MAC,
+	}
+	if change.OldIP != nil {
+		event.OldIP = change.OldIP.String()
+	}
+
+	return event
+}
+
+// writeDriftEvents writes one JSON object per line to w for each change that
+// is needed to undo drift.
+func writeDriftEvents(w io.Writer, drift host.ChangeSet) error {
+	enc := json.NewEncoder(w)
+	for _, change := range drift.Changes {
+		event := changeEvent{
+			Action:   actionDrift,
+			Hostname: change.Host.Name,
+			IP:       change.Host.IP.String(),
+			Repair:   change.Action,
+		}
+		if change.OldIP != nil {
+			event.OldIP = change.OldIP.String()
+		}
+
+		err := enc.Encode(event)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,8 +1,3 @@
 module github.com/grounded042/dhcp-hosts-updater
 
-require (
-	github.com/cbednarski/hostess v0.3.0
-	github.com/codegangsta/cli v1.20.0 // indirect
-)
-
 go 1.13
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/state"
+)
+
+// runHistory prints the runs recorded in the -state-file, oldest first.
+func runHistory() int {
+	if *stateFile == "" {
+		fmt.Fprintln(os.Stderr, "history requires -state-file")
+		return exitUsage
+	}
+
+	st, err := state.Load(*stateFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not load state file: %v\n", err)
+		return exitUsage
+	}
+
+	if len(st.Runs) == 0 && !*quiet {
+		fmt.Println("no runs recorded")
+	}
+
+	for _, run := range st.Runs {
+		providers := make([]string, 0, len(run.Fetched))
+		for provider := range run.Fetched {
+			providers = append(providers, provider)
+		}
+		sort.Strings(providers)
+
+		fetched := make([]string, 0, len(providers))
+		for _, provider := range providers {
+			fetched = append(fetched, fmt.Sprintf("%s=%d", provider, run.Fetched[provider]))
+		}
+
+		line := fmt.Sprintf("%s exit=%d duration=%v", run.Start.Local().Format(time.RFC3339), run.ExitCode, run.Duration.Round(time.Millisecond))
+		if len(fetched) > 0 {
+			line += fmt.Sprintf(" fetched=%s added=%d updated=%d removed=%d", strings.Join(fetched, ","), run.Added, run.Updated, run.Removed)
+		}
+		fmt.Println(line)
+		for _, err := range run.Errors {
+			fmt.Printf("  error: %s\n", err)
+		}
+	}
+
+	return exitOK
+}
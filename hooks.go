@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/host"
+)
+
+// runPostWriteHooks runs the hooks set up to follow changes written to the
+// hosts file. They run in the process writing it, the apply command when
+// there is a write helper, as they may need the same rights. The output of
+// -post-update-cmd goes to stdout.
+func runPostWriteHooks(ctx context.Context, changes host.ChangeSet, stdout io.Writer) {
+	if *postUpdateCmd != "" {
+		err := runPostUpdateCmd(ctx, *postUpdateCmd, changes, stdout)
+		if err != nil {
+			errorLog.Printf("post update command failed: %v", err)
+		}
+	}
+
+	if *flushDNS {
+		err := flushDNSCache(ctx)
+		if err != nil {
+			errorLog.Printf("could not flush DNS cache: %v", err)
+		}
+	}
+}
+
+// runPostUpdateCmd runs command through the system shell with the number of
+// changes made in DHCP_HOSTS_UPDATER_ADDED, DHCP_HOSTS_UPDATER_UPDATED, and
+// DHCP_HOSTS_UPDATER_REMOVED, writing its output to stdout.
+func runPostUpdateCmd(ctx context.Context, command string, changes host.ChangeSet, stdout io.Writer) error {
+	args := shellCommand(command)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+
+	cmd.Stdout = stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("DHCP_HOSTS_UPDATER_ADDED=%d", changes.Count(host.ActionAdd)),
+		fmt.Sprintf("DHCP_HOSTS_UPDATER_UPDATED=%d", changes.Count(host.ActionUpdate)),
+		fmt.Sprintf("DHCP_HOSTS_UPDATER_REMOVED=%d", changes.Count(host.ActionRemove)),
+	)
+
+	return cmd.Run()
+}
+
+// shellCommand returns the arguments running command through the system
+// shell.
+func shellCommand(command string) []string {
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C", command}
+	}
+
+	return []string{"/bin/sh", "-c", command}
+}
+
+// flushDNSCache makes macOS forget the lookups it cached, including those
+// answered from the hosts file, so that changes to it take effect at once.
+func flushDNSCache(ctx context.Context) error {
+	for _, args := range [][]string{{"dscacheutil", "-flushcache"}, {"killall", "-HUP", "mDNSResponder"}} {
+		out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %v: %s", args[0], err, bytes.TrimSpace(out))
+		}
+	}
+
+	return nil
+}
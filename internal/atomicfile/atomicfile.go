@@ -0,0 +1,147 @@
+// Package atomicfile replaces files so that neither readers nor a crash
+// ever see them partly written.
+package atomicfile
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// WriteFile replaces the file at path with data by writing it to a
+// temporary file in the same directory, syncing it to disk, and renaming it
+// over path. Readers see either the old or the new contents and a crash or
+// full disk can never leave a truncated file behind. The mode and, where the
+// OS supports it, ownership of an existing file are preserved, a new file is
+// created with perm. The temporary file is only readable by its owner until
+// then. If path is a symlink the file it points to is replaced. A file bind
+// mounted on its own, such as a host's hosts file mounted into a container,
+// cannot be renamed over, so it is overwritten in place instead.
+func WriteFile(path string, data []byte, perm os.FileMode) (err error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	switch {
+	case err == nil:
+		path = resolved
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		return err
+	}
+
+	if info != nil {
+		perm = info.Mode().Perm()
+		err = chown(tmp, info)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tmp.Chmod(perm)
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), path)
+	if errors.Is(err, syscall.EBUSY) {
+		os.Remove(tmp.Name())
+		return writeFileInPlace(path, data)
+	}
+	if err != nil {
+		return err
+	}
+
+	syncDir(filepath.Dir(path))
+
+	return nil
+}
+
+// writeFileInPlace truncates the file at path and writes data to it. Unlike
+// WriteFile, readers may see a partly written file, so it is only used
+// for files that cannot be replaced.
+func writeFileInPlace(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// syncDir flushes the directory entry of a rename to disk. It is best effort
+// as not every OS supports syncing directories.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	defer d.Close()
+
+	d.Sync()
+}
+
+// CheckWritable reports whether WriteFile could replace the file at
+// path, by creating a temporary file next to it and giving it the file's
+// ownership, without touching the file itself.
+func CheckWritable(path string) error {
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	return chown(tmp, info)
+}
@@ -0,0 +1,62 @@
+package atomicfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomicfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "file")
+	err = WriteFile(path, []byte("new"), 0600)
+	if err != nil {
+		t.Fatalf("WriteFile() of a new file error = %v", err)
+	}
+	checkFile(t, path, "new", 0600)
+
+	err = os.Chmod(path, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = WriteFile(path, []byte("replaced"), 0600)
+	if err != nil {
+		t.Fatalf("WriteFile() of an existing file error = %v", err)
+	}
+	checkFile(t, path, "replaced", 0644)
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("WriteFile() left %d files behind, want only %s", len(entries), path)
+	}
+}
+
+func checkFile(t *testing.T, path, want string, perm os.FileMode) {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != want {
+		t.Errorf("%s holds %q, want %q", path, data, want)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != perm {
+		t.Errorf("%s has mode %v, want %v", path, info.Mode().Perm(), perm)
+	}
+}
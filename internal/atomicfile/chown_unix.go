@@ -0,0 +1,29 @@
+//go:build !windows
+// +build !windows
+
+package atomicfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// chown gives f the owner and group of the file described by info, if they
+// differ.
+func chown(f *os.File, info os.FileInfo) error {
+	want, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+
+	current, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if have, ok := current.Sys().(*syscall.Stat_t); ok && have.Uid == want.Uid && have.Gid == want.Gid {
+		return nil
+	}
+
+	return f.Chown(int(want.Uid), int(want.Gid))
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// logIdentifier tags the messages sent to syslog and the journal.
+const logIdentifier = "dhcp-hosts-updater"
+
+// The loggers for messages above the informational priority of the standard
+// logger. By default they write to stderr, errors without a timestamp as
+// they always have been.
+var (
+	warnLog  = log.New(os.Stderr, "", log.LstdFlags)
+	errorLog = log.New(os.Stderr, "", 0)
+)
+
+// setupLogging points the standard logger, warnLog, and errorLog at target:
+// stderr, syslog, or journald.
+func setupLogging(target string) error {
+	var info, warn, err io.Writer
+	switch target {
+	case "stderr":
+		return nil
+	case "syslog":
+		var dialErr error
+		info, warn, err, dialErr = syslogWriters()
+		if dialErr != nil {
+			return fmt.Errorf("could not connect to syslog: %v", dialErr)
+		}
+	case "journald":
+		var dialErr error
+		info, warn, err, dialErr = journaldWriters()
+		if dialErr != nil {
+			return fmt.Errorf("could not connect to the journal: %v", dialErr)
+		}
+	default:
+		return fmt.Errorf("unknown log target %q, expected stderr, syslog, or journald", target)
+	}
+
+	// Both syslog and the journal timestamp messages themselves.
+	log.SetOutput(info)
+	log.SetFlags(0)
+	warnLog.SetOutput(warn)
+	warnLog.SetFlags(0)
+	errorLog.SetOutput(err)
+
+	return nil
+}
@@ -0,0 +1,74 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/syslog"
+	"net"
+	"strings"
+)
+
+// syslogWriters returns writers logging to the local syslog daemon at the
+// info, warning, and error priorities.
+func syslogWriters() (info, warn, err io.Writer, dialErr error) {
+	writers := make([]io.Writer, 0, 3)
+	for _, priority := range []syslog.Priority{syslog.LOG_INFO, syslog.LOG_WARNING, syslog.LOG_ERR} {
+		w, dialErr := syslog.New(syslog.LOG_DAEMON|priority, logIdentifier)
+		if dialErr != nil {
+			return nil, nil, nil, dialErr
+		}
+		writers = append(writers, w)
+	}
+
+	return writers[0], writers[1], writers[2], nil
+}
+
+// journalSocket is where journald receives messages in its native protocol.
+const journalSocket = "/run/systemd/journal/socket"
+
+// journaldWriters returns writers logging to the systemd journal at the info,
+// warning, and error priorities.
+func journaldWriters() (info, warn, err io.Writer, dialErr error) {
+	conn, dialErr := net.Dial("unixgram", journalSocket)
+	if dialErr != nil {
+		return nil, nil, nil, dialErr
+	}
+
+	return &journalWriter{conn: conn, priority: 6},
+		&journalWriter{conn: conn, priority: 4},
+		&journalWriter{conn: conn, priority: 3},
+		nil
+}
+
+// journalWriter sends each write as a journal entry at a fixed priority.
+type journalWriter struct {
+	conn     net.Conn
+	priority int
+}
+
+func (w *journalWriter) Write(p []byte) (int, error) {
+	message := strings.TrimSuffix(string(p), "\n")
+
+	entry := fmt.Sprintf("PRIORITY=%d\nSYSLOG_IDENTIFIER=%s\n", w.priority, logIdentifier)
+	if strings.Contains(message, "\n") {
+		// Values containing newlines are sent as the field name, a newline,
+		// the value's length as a little endian uint64, and the value.
+		var size [8]byte
+		for i := range size {
+			size[i] = byte(uint64(len(message)) >> (8 * i))
+		}
+		entry += "MESSAGE\n" + string(size[:]) + message + "\n"
+	} else {
+		entry += "MESSAGE=" + message + "\n"
+	}
+
+	_, err := w.conn.Write([]byte(entry))
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"errors"
+	"io"
+)
+
+var errLogTargetUnsupported = errors.New("not supported on Windows")
+
+func syslogWriters() (info, warn, err io.Writer, dialErr error) {
+	return nil, nil, nil, errLogTargetUnsupported
+}
+
+func journaldWriters() (info, warn, err io.Writer, dialErr error) {
+	return nil, nil, nil, errLogTargetUnsupported
+}
@@ -1,83 +1,487 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"net"
+	"net/url"
 	"os"
+	"runtime"
 	"strings"
+	"text/template"
+	"time"
 
-	"github.com/cbednarski/hostess"
+	_ "github.com/grounded042/dhcp-hosts-updater/pkg/edgeos"
+	"github.com/grounded042/dhcp-hosts-updater/pkg/host"
+	"github.com/grounded042/dhcp-hosts-updater/pkg/hosts"
+	"github.com/grounded042/dhcp-hosts-updater/pkg/notify"
+	"github.com/grounded042/dhcp-hosts-updater/pkg/provider"
+	"github.com/grounded042/dhcp-hosts-updater/pkg/state"
 )
 
-type externalHostsProvider interface {
-	GetHosts() map[string]net.IP
+// Exit codes returned by the updater so that cron, systemd, and monitoring can
+// tell the outcome of a run apart.
+const (
+	exitOK             = 0 // success, the hosts file did not need changing
+	exitUsage          = 1 // invalid arguments
+	exitChanged        = 2 // success, changes were written to the hosts file, or would have been with -dry-run
+	exitProviderError  = 3 // a provider could not be queried
+	exitHostsFileError = 4 // the hosts file could not be read or written
+	exitPartialFailure = 5 // some providers failed while others succeeded, the hosts of the others were updated
+)
+
+var (
+	hostsFile       = flag.String("hosts-file", "", "hosts `file` to update, defaults to $"+hosts.PathEnv+" or the system hosts file; in a container, bind mount the host's hosts file, e.g. with docker run -v /etc/hosts:/host/etc/hosts, and point this at it")
+	container       = flag.String("container", containerAuto, "`mode` for running in a Docker, Podman, or Kubernetes container: on refuses to update the container's own or ephemeral hosts files, auto does so when a container is detected, off never does")
+	backupRetention = flag.Int("backup-retention", 5, "number of hosts file backups to keep, 0 disables backups")
+	showDiff        = flag.Bool("diff", false, "print the changes made to the hosts file")
+	dryRun          = flag.Bool("dry-run", false, "print the changes that would be made to the hosts file without writing it, implies -diff")
+	noColor         = flag.Bool("no-color", false, "disable colored diff output")
+	outputEvents    = flag.String("output-events", "", "emit a `format` object on stdout for each change made, the only supported format is json")
+	retries         = flag.Int("retries", 2, "number of times to retry fetching hosts from a provider that failed with a connection error, timeout, or 5xx response")
+	retryBackoff    = flag.Duration("retry-backoff", time.Second, "delay before the first retry, doubled for each retry after")
+	fetchTimeout    = flag.Duration("fetch-timeout", 0, "timeout for each attempt at fetching hosts from a provider, 0 means none")
+	minInterval     = flag.Duration("min-interval", 0, "minimum time between the HTTP requests to the same provider, including logins and retries, 0 means no limit")
+	cacheDir        = flag.String("cache-dir", "", "`directory` to cache provider hosts in, used when a provider is unreachable")
+	cacheMaxAge     = flag.Duration("cache-max-staleness", 24*time.Hour, "how old cached provider hosts may be and still be used, 0 means no limit")
+	sessionDir      = flag.String("session-dir", "", "`directory` to keep provider login sessions in, encrypted with the provider's password, so that runs resume them instead of logging in again")
+	duplicates      = flag.String("duplicates", string(host.KeepLast), "`policy` for hostnames reported with several IPs: last keeps the last reported, static prefers static mappings")
+	proxy           = flag.String("proxy", "", "`URL` of the proxy to reach providers through, e.g. socks5://proxy:1080, or ssh://user@bastion to tunnel through an SSH jump host with the ssh client and its keys; defaults to $HTTPS_PROXY and $HTTP_PROXY")
+	webhookURL      = flag.String("webhook-url", "", "`URL` to POST a JSON description of the changes to after changes were written to the hosts file")
+	slackURL        = flag.String("slack-webhook-url", "", "Slack incoming webhook `URL` to announce changes to")
+	discordURL      = flag.String("discord-webhook-url", "", "Discord webhook `URL` to announce changes to")
+	telegramToken   = flag.String("telegram-token", "", "Telegram bot `token` to announce changes with, requires -telegram-chat-id")
+	telegramChatID  = flag.String("telegram-chat-id", "", "Telegram chat `id` to announce changes to")
+	notifyTemplate  = flag.String("notify-template", "", "`file` holding a Go text/template for Slack, Discord, and Telegram messages, executed with the webhook payload")
+	smtpAddr        = flag.String("smtp-addr", "", "`host:port` of the SMTP server to email changes through, requires -smtp-from and -smtp-to")
+	smtpSecurity    = flag.String("smtp-security", string(notify.SMTPStartTLS), "how to secure the SMTP connection: starttls, tls, or none")
+	smtpUsername    = flag.String("smtp-username", "", "`username` to authenticate to the SMTP server with, if it requires it")
+	smtpPassword    = flag.String("smtp-password", "", "`password` to authenticate to the SMTP server with")
+	smtpFrom        = flag.String("smtp-from", "", "email `address` to send from")
+	smtpTo          = flag.String("smtp-to", "", "comma separated email `addresses` to send to")
+	pingURL         = flag.String("ping-url", "", "`URL` to GET after every successful update, with /fail appended after a failed one, e.g. a healthchecks.io check")
+	auditLog        = flag.String("audit-log", "", "`file` to append a JSON line to for every change written to the hosts file")
+	stateFile       = flag.String("state-file", "", "`file` to remember the devices seen and recent runs in, enabling new device announcements and the history command")
+	historySize     = flag.Int("history-size", 50, "number of recent runs to keep in the -state-file, 0 to keep none")
+	postUpdateCmd   = flag.String("post-update-cmd", "", "shell `command` to run after changes were written to the hosts file")
+	writeHelper     = flag.String("write-helper", "", "shell `command` running the apply command with the rights to write the hosts file, e.g. sudo -n /usr/local/bin/dhcp-hosts-updater apply, so that this process needs none and root never holds the provider credentials")
+	flushDNS        = flag.Bool("flush-dns", false, "flush the macOS DNS cache after changes were written to the hosts file, so that they take effect at once")
+	serviceUser     = flag.String("service-user", "", "`user` the service installed by service install runs as instead of root; required with -write-helper, so that only the helper runs as root")
+	serviceInterval = flag.Duration("service-interval", 5*time.Minute, "`interval` between the runs of the service installed by service install, unless -interval runs it as a daemon")
+	interval        = flag.Duration("interval", 0, "run as a daemon updating the hosts file every `interval`, 0 updates it once and exits")
+	driftInterval   = flag.Duration("drift-check-interval", 0, "when running as a daemon, check every `interval` between updates that the hosts file still holds the managed entries, warning if it was edited, 0 disables the check")
+	listen          = flag.String("listen", "", "`address` to serve Prometheus metrics on at /metrics, a read-only JSON API at /hosts, /hosts/{name}, and /changes, and to accept POST /sync update triggers on, when running as a daemon, e.g. :9100")
+	dashboard       = flag.Bool("dashboard", false, "serve a web dashboard of the hosts, recent changes, and provider health at / on the -listen address")
+	debounce        = flag.Duration("debounce", 2*time.Second, "when running as a daemon, run an update triggered by SIGHUP or POST /sync once no trigger arrived for `duration`, so that a burst of triggers causes a single update")
+	debounceMaxWait = flag.Duration("debounce-max-wait", 30*time.Second, "when running as a daemon, run a triggered update at most `duration` after the first trigger, however often it is triggered in between, 0 means no limit")
+	logTarget       = flag.String("log-target", "stderr", "where to log to: stderr, syslog, or journald")
+	sinkParallelism = flag.Int("sink-parallelism", 4, "maximum number of hosts files written at once")
+	quiet           = flag.Bool("quiet", false, "only print output when changes were made or an error occurred")
+)
+
+// pluginDirEnv names the environment variable pointing at a directory of
+// provider plugins. It is read from the environment rather than a flag as the
+// plugins need registering before their flags can be parsed.
+const pluginDirEnv = "DHCP_HOSTS_UPDATER_PLUGIN_DIR"
+
+// extraHostsFiles holds the -extra-hosts-file flags.
+var extraHostsFiles stringList
+
+// stringList is a flag.Value collecting the values of a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
 func main() {
-	address := os.Args[1]
-	username := os.Args[2]
-	password := os.Args[3]
+	// The apply command runs with the rights to write the hosts file and has
+	// no use for providers, so it does not run the plugins.
+	if dir := os.Getenv(pluginDirEnv); dir != "" && !isApplyCommand(os.Args[1:]) {
+		err := provider.RegisterPlugins(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not load plugins: %v\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+
+	registerProviderFlags(flag.CommandLine)
+	flag.Var(&extraHostsFiles, "extra-hosts-file", "`file` to also write the hosts to, written alongside the system hosts file, e.g. a dnsmasq addn-hosts file; may be repeated")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage:\n  %[1]s [flags]\n  %[1]s [flags] check|stats\n  %[1]s rollback\n  %[1]s apply\n  %[1]s -state-file=<file> history\n  %[1]s [flags] service install\n  %[1]s [flags] [check|stats] <address> <username> <password>\n\nThe positional form is shorthand for the -edgeos.* flags. Further providers\nare loaded from the plugin executables in $%[2]s.\n\nFlags:\n", os.Args[0], pluginDirEnv)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	os.Exit(run(flag.Args()))
+}
 
-	p, err := newEdgeOSHostsProvider(address, username, password)
+// isApplyCommand reports whether args run the apply command. It looks at the
+// arguments before they are parsed, as the plugins must be registered first;
+// the apply command takes no arguments, so it is always the last one.
+func isApplyCommand(args []string) bool {
+	return len(args) > 0 && args[len(args)-1] == "apply"
+}
+
+// hostsPath returns the location of the hosts file to update.
+func hostsPath() string {
+	if *hostsFile != "" {
+		return *hostsFile
+	}
+
+	return hosts.DefaultPath()
+}
+
+func run(args []string) int {
+	err := setupLogging(*logTarget)
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+
+	if *container != containerAuto && *container != containerOn && *container != containerOff {
+		fmt.Fprintf(os.Stderr, "unsupported -container mode %q\n", *container)
+		return exitUsage
+	}
+
+	if *flushDNS && runtime.GOOS != "darwin" {
+		fmt.Fprintln(os.Stderr, "-flush-dns is only supported on macOS")
+		return exitUsage
+	}
+
+	if len(args) == 1 && args[0] == "rollback" {
+		restored, err := host.Rollback(hostsPath())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not roll back hosts file: %v\n", err)
+			return exitHostsFileError
+		}
+		fmt.Printf("restored %s from %s\n", hostsPath(), restored)
+		return exitOK
+	}
+
+	if len(args) == 1 && args[0] == "history" {
+		return runHistory()
 	}
 
-	err = updateHostsFile(p.GetHosts())
+	if len(args) == 1 && args[0] == "apply" {
+		return runApply()
+	}
+
+	if len(args) > 0 && args[0] == "service" {
+		return runService(args[1:])
+	}
+
+	// check and stats use the providers without touching the hosts file.
+	command := ""
+	if len(args) > 0 && (args[0] == "check" || args[0] == "stats") {
+		command = args[0]
+		args = args[1:]
+	}
+
+	switch len(args) {
+	case 0:
+	case 3:
+		*providerFlags["edgeos"]["address"] = args[0]
+		*providerFlags["edgeos"]["username"] = args[1]
+		*providerFlags["edgeos"]["password"] = args[2]
+	default:
+		flag.Usage()
+		return exitUsage
+	}
+
+	active, err := activeProviders()
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeFor(err)
+	}
+
+	if len(active) == 0 {
+		flag.Usage()
+		return exitUsage
 	}
-}
 
-func updateHostsFile(hosts map[string]net.IP) error {
-	hostfile := hostess.NewHostfile()
-	err := hostfile.Read()
+	duplicatePolicy, err := host.ParseDuplicatePolicy(*duplicates)
 	if err != nil {
-		return err
+		fmt.Fprintf(os.Stderr, "invalid -duplicates: %v\n", err)
+		return exitUsage
+	}
+
+	var providerOpts []provider.Option
+	if *proxy != "" {
+		proxyURL, err := url.Parse(*proxy)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -proxy: %v\n", err)
+			return exitUsage
+		}
+		if proxyURL.Scheme == "ssh" && proxyURL.Hostname() == "" {
+			fmt.Fprintln(os.Stderr, "invalid -proxy: the ssh jump host is missing, e.g. ssh://user@bastion")
+			return exitUsage
+		}
+		providerOpts = append(providerOpts, provider.WithProxy(proxyURL))
+	}
+	if *sessionDir != "" {
+		providerOpts = append(providerOpts, provider.WithSessionStore(&provider.FileSessionStore{Dir: *sessionDir}))
+	}
+
+	switch command {
+	case "check":
+		return runCheck(active, providerOpts)
+	case "stats":
+		return runStats(active, providerOpts)
+	}
+
+	if *outputEvents != "" && *outputEvents != "json" {
+		fmt.Fprintf(os.Stderr, "unsupported -output-events format %q\n", *outputEvents)
+		return exitUsage
+	}
+
+	if *listen != "" && *interval == 0 {
+		fmt.Fprintln(os.Stderr, "-listen requires -interval")
+		return exitUsage
+	}
+
+	if *dashboard && *listen == "" {
+		fmt.Fprintln(os.Stderr, "-dashboard requires -listen")
+		return exitUsage
+	}
+
+	if *driftInterval > 0 && *interval == 0 {
+		fmt.Fprintln(os.Stderr, "-drift-check-interval requires -interval")
+		return exitUsage
+	}
+
+	if *writeHelper != "" && (*postUpdateCmd != "" || *flushDNS) {
+		fmt.Fprintln(os.Stderr, "-post-update-cmd and -flush-dns run after the write helper wrote the hosts file; pass them to its apply command, which has the rights they need")
+		return exitUsage
+	}
+
+	if *debounce < 0 {
+		fmt.Fprintln(os.Stderr, "-debounce must not be negative")
+		return exitUsage
 	}
 
-	errs := hostfile.Parse()
-	if len(errs) != 0 {
-		return fmt.Errorf("multiple errors parsing hosts file! %v", errs)
+	if *debounceMaxWait < 0 {
+		fmt.Fprintln(os.Stderr, "-debounce-max-wait must not be negative")
+		return exitUsage
 	}
 
-	for name, ip := range hosts {
-		if name == "" {
+	if *historySize < 0 {
+		fmt.Fprintln(os.Stderr, "-history-size must not be negative")
+		return exitUsage
+	}
+
+	sink := &host.HostsFile{Path: hostsPath()}
+	hostsFiles := []*host.HostsFile{sink}
+	for _, path := range extraHostsFiles {
+		hostsFiles = append(hostsFiles, &host.HostsFile{Path: path})
+	}
+
+	checkContainer := containerChecks()
+
+	multiSink := &host.MultiSink{Parallelism: *sinkParallelism}
+	for i, f := range hostsFiles {
+		f.BackupRetention = *backupRetention
+		f.DryRun = *dryRun
+
+		// The write helper checks the system hosts file itself when it
+		// writes it.
+		if i == 0 && *writeHelper != "" && !*dryRun {
+			multiSink.Sinks = append(multiSink.Sinks, &host.HelperSink{Command: shellCommand(*writeHelper), Path: f.Path})
 			continue
 		}
 
-		if removeHostsThatMatchIPAndNotDomain(&hostfile.Hosts, ip, name) {
-			continue
+		err = f.Preflight()
+		if err == nil && checkContainer && !f.DryRun {
+			err = checkContainerHostsFile(f.Path)
+		}
+		if err != nil {
+			errorLog.Printf("hosts file check failed: %v", err)
+			if *pingURL != "" && !*dryRun {
+				ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+				err := ping(ctx, *pingURL, false)
+				cancel()
+				if err != nil {
+					errorLog.Printf("could not ping %s: %v", *pingURL, err)
+				}
+			}
+			return exitHostsFileError
 		}
 
-		hostfile.Hosts.Add(&hostess.Hostname{
-			Domain:  name,
-			IP:      ip,
-			Enabled: true,
-		})
+		multiSink.Sinks = append(multiSink.Sinks, f)
 	}
 
-	return hostfile.Save()
-}
+	retry := host.Retry{
+		Attempts: *retries + 1,
+		Backoff:  *retryBackoff,
+		Timeout:  *fetchTimeout,
+	}
+
+	updaterSink := multiSink.Sinks[0]
+	if len(hostsFiles) > 1 {
+		updaterSink = multiSink
+	}
+	updater := host.NewUpdater(updaterSink)
+	updater.Duplicates = duplicatePolicy
+	updater.Retry = retry
+	if !*quiet {
+		updater.OnInvalidHost = func(h host.Host, reason string) {
+			warnLog.Printf("skipping host %q with IP %v and MAC %q: %s", h.Name, h.IP, h.MAC, reason)
+		}
+	}
+	if *cacheDir != "" {
+		updater.Cache = &host.FileCache{Dir: *cacheDir}
+	} else if *interval > 0 {
+		updater.Cache = &host.MemoryCache{}
+	}
+	if updater.Cache != nil {
+		updater.MaxStaleness = *cacheMaxAge
+		updater.OnCacheFallback = func(provider string, err error, fetchedAt time.Time) {
+			warnLog.Printf("using hosts cached at %s for %s: %v", fetchedAt.Format(time.RFC3339), provider, err)
+		}
+	}
+	notifiers, err := newNotifiers()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if !*dryRun {
+		updater.OnAfterApply = func(ctx context.Context, changes host.ChangeSet) {
+			if changes.Empty() {
+				return
+			}
 
-// removeHostsThatMatchIPAndNotDomain removes any hosts from the host list that
-// have the passed in IP but do not have the domain associated with the IP. It
-// returns true if there is an entry for the ip that has the matching domain
-func removeHostsThatMatchIPAndNotDomain(hosts *hostess.Hostlist, ip net.IP, domain string) bool {
-	entryForIPHasDomain := false
-
-	if hosts.ContainsIP(ip) {
-		for _, matchingEntry := range hosts.FilterByIP(ip) {
-			if strings.ToLower(matchingEntry.Domain) == strings.ToLower(domain) {
-				if !matchingEntry.Enabled {
-					hosts.Enable(domain)
+			if *auditLog != "" {
+				err := appendAuditLog(*auditLog, changes, time.Now())
+				if err != nil {
+					errorLog.Printf("could not write audit log: %v", err)
 				}
-				entryForIPHasDomain = true
-			} else {
-				hosts.Remove(hosts.IndexOf(matchingEntry))
 			}
+
+			runPostWriteHooks(ctx, changes, os.Stdout)
+		}
+	}
+
+	var st *state.State
+	if *stateFile != "" {
+		st, err = state.Load(*stateFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not load state file: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	s := &syncer{
+		active:       active,
+		providerOpts: providerOpts,
+		retry:        retry,
+		sink:         sink,
+		updater:      updater,
+		notifiers:    notifiers,
+		state:        st,
+	}
+
+	if *interval > 0 {
+		return runDaemon(s, *interval, *driftInterval, *debounce, *debounceMaxWait, *listen, *dashboard)
+	}
+
+	return s.sync(context.Background())
+}
+
+// newNotifiers returns the notifiers enabled by the flags.
+func newNotifiers() ([]notify.Notifier, error) {
+	var tmpl *template.Template
+	if *notifyTemplate != "" {
+		text, err := ioutil.ReadFile(*notifyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("could not read -notify-template: %v", err)
+		}
+
+		tmpl, err = notify.ParseTemplate(string(text))
+		if err != nil {
+			return nil, fmt.Errorf("invalid -notify-template: %v", err)
+		}
+	}
+
+	if (*telegramToken == "") != (*telegramChatID == "") {
+		return nil, errors.New("-telegram-token and -telegram-chat-id must be set together")
+	}
+
+	var notifiers []notify.Notifier
+	if *smtpAddr != "" {
+		email, err := newEmail(tmpl)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, email)
+	}
+	if *webhookURL != "" {
+		notifiers = append(notifiers, &notify.Webhook{URL: *webhookURL})
+	}
+	if *slackURL != "" {
+		notifiers = append(notifiers, &notify.Slack{WebhookURL: *slackURL, Template: tmpl})
+	}
+	if *discordURL != "" {
+		notifiers = append(notifiers, &notify.Discord{WebhookURL: *discordURL, Template: tmpl})
+	}
+	if *telegramToken != "" {
+		notifiers = append(notifiers, &notify.Telegram{Token: *telegramToken, ChatID: *telegramChatID, Template: tmpl})
+	}
+
+	return notifiers, nil
+}
+
+// newEmail returns the Email notifier configured by the -smtp flags.
+func newEmail(tmpl *template.Template) (*notify.Email, error) {
+	if _, _, err := net.SplitHostPort(*smtpAddr); err != nil {
+		return nil, fmt.Errorf("invalid -smtp-addr: %v", err)
+	}
+
+	security, err := notify.ParseSMTPSecurity(*smtpSecurity)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -smtp-security: %v", err)
+	}
+
+	var to []string
+	for _, addr := range strings.Split(*smtpTo, ",") {
+		addr = strings.TrimSpace(addr)
+		if addr != "" {
+			to = append(to, addr)
 		}
 	}
+	if *smtpFrom == "" || len(to) == 0 {
+		return nil, errors.New("-smtp-addr requires -smtp-from and -smtp-to")
+	}
 
-	return entryForIPHasDomain
+	return &notify.Email{
+		Addr:     *smtpAddr,
+		Security: security,
+		Username: *smtpUsername,
+		Password: *smtpPassword,
+		From:     *smtpFrom,
+		To:       to,
+		Template: tmpl,
+	}, nil
+}
+
+// exitCodeFor returns the exit code reporting err.
+func exitCodeFor(err error) int {
+	var providerErr *provider.Error
+	switch {
+	case errors.Is(err, provider.ErrUnknownProvider), errors.Is(err, provider.ErrMissingFlag), errors.Is(err, provider.ErrUnknownFlag):
+		return exitUsage
+	case errors.As(err, &providerErr), errors.Is(err, provider.ErrAuthFailed):
+		return exitProviderError
+	case errors.Is(err, host.ErrHostsParse):
+		return exitHostsFileError
+	default:
+		return exitHostsFileError
+	}
 }
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/host"
+)
+
+// metrics collects the state of the daemon and serves it on /metrics in the
+// Prometheus text exposition format. A nil *metrics discards observations, so
+// one-shot runs need not check for it.
+type metrics struct {
+	mu               sync.Mutex
+	providerHosts    map[string]int
+	providerErrors   map[string]int
+	providerDuration map[string]time.Duration
+	providerFetches  map[string]int
+	changes          map[host.Action]int
+	lastRunChanges   map[host.Action]int
+	syncs            int
+	lastSuccess      time.Time
+	driftChecks      int
+	driftDetected    int
+	driftedEntries   int
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		providerHosts:    map[string]int{},
+		providerErrors:   map[string]int{},
+		providerDuration: map[string]time.Duration{},
+		providerFetches:  map[string]int{},
+		changes:          map[host.Action]int{},
+		lastRunChanges:   map[host.Action]int{},
+	}
+}
+
+// providerFetched records an attempt at fetching the hosts of a provider.
+func (m *metrics) providerFetched(provider string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.providerDuration[provider] += duration
+	m.providerFetches[provider]++
+	if err != nil {
+		m.providerErrors[provider]++
+	}
+}
+
+// providerError records a provider failing outside of a fetch, such as when
+// logging in.
+func (m *metrics) providerError(provider string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.providerErrors[provider]++
+}
+
+// fetched records the number of hosts each provider returned.
+func (m *metrics) fetched(fetched map[string][]host.Host) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for provider, hosts := range fetched {
+		m.providerHosts[provider] = len(hosts)
+	}
+}
+
+// synced records the changes made by a sync that reached the hosts file, and
+// whether every provider succeeded.
+func (m *metrics) synced(changes host.ChangeSet, complete bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.syncs++
+	for _, action := range []host.Action{host.ActionAdd, host.ActionUpdate, host.ActionRemove} {
+		n := changes.Count(action)
+		m.changes[action] += n
+		m.lastRunChanges[action] = n
+	}
+	if complete {
+		m.lastSuccess = time.Now()
+	}
+}
+
+// driftChecked records the outcome of a drift check.
+func (m *metrics) driftChecked(drift host.ChangeSet) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.driftChecks++
+	if !drift.Empty() {
+		m.driftDetected++
+	}
+	m.driftedEntries = len(drift.Changes)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	writeMetricHeader(w, "dhcp_hosts_updater_provider_hosts", "gauge", "Number of hosts returned by the provider in the last successful fetch.")
+	for _, provider := range sortedKeys(m.providerHosts) {
+		fmt.Fprintf(w, "dhcp_hosts_updater_provider_hosts{provider=%q} %d\n", provider, m.providerHosts[provider])
+	}
+
+	writeMetricHeader(w, "dhcp_hosts_updater_provider_errors_total", "counter", "Number of failed logins and fetches per provider.")
+	for _, provider := range sortedKeys(m.providerErrors) {
+		fmt.Fprintf(w, "dhcp_hosts_updater_provider_errors_total{provider=%q} %d\n", provider, m.providerErrors[provider])
+	}
+
+	writeMetricHeader(w, "dhcp_hosts_updater_provider_fetch_duration_seconds", "summary", "Time taken to fetch the hosts of a provider, including retries.")
+	for _, provider := range sortedKeys(m.providerFetches) {
+		fmt.Fprintf(w, "dhcp_hosts_updater_provider_fetch_duration_seconds_sum{provider=%q} %g\n", provider, m.providerDuration[provider].Seconds())
+		fmt.Fprintf(w, "dhcp_hosts_updater_provider_fetch_duration_seconds_count{provider=%q} %d\n", provider, m.providerFetches[provider])
+	}
+
+	writeMetricHeader(w, "dhcp_hosts_updater_changes_total", "counter", "Number of hosts file entries changed, by action.")
+	for _, action := range []host.Action{host.ActionAdd, host.ActionUpdate, host.ActionRemove} {
+		fmt.Fprintf(w, "dhcp_hosts_updater_changes_total{action=%q} %d\n", action, m.changes[action])
+	}
+
+	writeMetricHeader(w, "dhcp_hosts_updater_last_run_changes", "gauge", "Number of hosts file entries changed by the last sync, by action.")
+	for _, action := range []host.Action{host.ActionAdd, host.ActionUpdate, host.ActionRemove} {
+		fmt.Fprintf(w, "dhcp_hosts_updater_last_run_changes{action=%q} %d\n", action, m.lastRunChanges[action])
+	}
+
+	writeMetricHeader(w, "dhcp_hosts_updater_syncs_total", "counter", "Number of syncs that reached the hosts file.")
+	fmt.Fprintf(w, "dhcp_hosts_updater_syncs_total %d\n", m.syncs)
+
+	writeMetricHeader(w, "dhcp_hosts_updater_last_success_timestamp_seconds", "gauge", "Unix time of the last sync in which every provider succeeded, 0 if none has.")
+	lastSuccess := int64(0)
+	if !m.lastSuccess.IsZero() {
+		lastSuccess = m.lastSuccess.Unix()
+	}
+	fmt.Fprintf(w, "dhcp_hosts_updater_last_success_timestamp_seconds %d\n", lastSuccess)
+
+	writeMetricHeader(w, "dhcp_hosts_updater_drift_checks_total", "counter", "Number of checks of the hosts file for entries edited by something else.")
+	fmt.Fprintf(w, "dhcp_hosts_updater_drift_checks_total %d\n", m.driftChecks)
+
+	writeMetricHeader(w, "dhcp_hosts_updater_drift_detected_total", "counter", "Number of drift checks that found managed entries edited by something else.")
+	fmt.Fprintf(w, "dhcp_hosts_updater_drift_detected_total %d\n", m.driftDetected)
+
+	writeMetricHeader(w, "dhcp_hosts_updater_drifted_entries", "gauge", "Number of hosts file entries the last drift check found edited by something else.")
+	fmt.Fprintf(w, "dhcp_hosts_updater_drifted_entries %d\n", m.driftedEntries)
+}
+
+func writeMetricHeader(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// pingTimeout bounds each -ping-url request so that an unreachable
+// monitoring service cannot hold up syncing.
+const pingTimeout = 10 * time.Second
+
+// ping GETs url after a successful sync, or url with /fail appended after a
+// failed one, following the convention of healthchecks.io and similar dead
+// man's switch services.
+func ping(ctx context.Context, url string, success bool) error {
+	if !success {
+		url = strings.TrimSuffix(url, "/") + "/fail"
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package edgeos
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// sharedNetworksPath is where the DHCP shared networks sit in the response of
+// get.json, which holds the entire configuration of the router.
+var sharedNetworksPath = []string{"GET", "service", "dhcp-server", "shared-network-name"}
+
+// decodeSharedNetworks decodes the DHCP shared networks from a get.json
+// response as it is read, skipping over the rest of the configuration token
+// by token so that it is never held in memory. A configuration without a
+// DHCP server has no shared networks.
+func decodeSharedNetworks(r io.Reader) (map[string]edgeOSSharedNetwork, error) {
+	dec := json.NewDecoder(r)
+
+	found, err := seek(dec, sharedNetworksPath)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	var sharedNetworks map[string]edgeOSSharedNetwork
+	err = dec.Decode(&sharedNetworks)
+	if err != nil {
+		return nil, err
+	}
+
+	return sharedNetworks, nil
+}
+
+// seek advances dec to the value found by following the object keys in path,
+// reporting whether it exists.
+func seek(dec *json.Decoder, path []string) (bool, error) {
+	for _, key := range path {
+		tok, err := dec.Token()
+		if err != nil {
+			return false, err
+		}
+		if tok != json.Delim('{') {
+			// A missing section may be null or an empty string.
+			return false, nil
+		}
+
+		found := false
+		for !found {
+			tok, err := dec.Token()
+			if err != nil {
+				return false, err
+			}
+			if tok == json.Delim('}') {
+				return false, nil
+			}
+
+			name, ok := tok.(string)
+			if !ok {
+				return false, fmt.Errorf("unexpected %v in object", tok)
+			}
+			if name == key {
+				found = true
+				continue
+			}
+
+			err = skip(dec)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// skip discards the next value read by dec, however deeply nested.
+func skip(dec *json.Decoder) error {
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch tok {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,481 @@
+// Package edgeos provides hosts from the DHCP leases and static mappings of an
+// EdgeOS router. Importing it registers the "edgeos" provider, and Client can
+// also be used directly.
+package edgeos
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/provider"
+)
+
+type dhcpLeasesResponse struct {
+	Success string           `json:"success"`
+	Output  dhcpLeasesOutput `json:"output"`
+}
+
+type dhcpLeasesOutput struct {
+	DHCPServerLeases map[string]dhcpServerLeaseGroup `json:"dhcp-server-leases"`
+}
+
+// dhcpServerLeaseGroup is the leases of a shared network keyed by IP. EdgeOS
+// sends an empty string instead of an object for a network without leases.
+type dhcpServerLeaseGroup map[string]dhcpServerLease
+
+func (g *dhcpServerLeaseGroup) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		*g = nil
+		return nil
+	case len(data) > 0 && data[0] == '"':
+		var s string
+		err := json.Unmarshal(data, &s)
+		if err != nil {
+			return err
+		}
+		if s != "" {
+			return fmt.Errorf("unexpected dhcp lease group %q", s)
+		}
+		*g = nil
+		return nil
+	default:
+		leases := map[string]dhcpServerLease{}
+		err := json.Unmarshal(data, &leases)
+		if err != nil {
+			return err
+		}
+		*g = leases
+		return nil
+	}
+}
+
+type dhcpServerLease struct {
+	Expiration     string `json:"expiration"`
+	Pool           string `json:"pool"`
+	Mac            string `json:"mac"`
+	ClientHostname string `json:"client-hostname"`
+}
+
+// Client is a logged in session with the API of an EdgeOS router. It
+// implements provider.HostsProvider.
+type Client struct {
+	httpClient *http.Client
+	baseURL    *url.URL
+	logger     *log.Logger
+
+	username string
+	password string
+	sessions provider.SessionStore
+	// resumed is set while the session restored from sessions has not been
+	// used successfully yet.
+	resumed bool
+}
+
+// GetHosts returns the hostnames of the router's DHCP leases and static
+// mappings. Static mappings come first so that they lose to leases for the
+// same hostname.
+func (e *Client) GetHosts(ctx context.Context) ([]provider.Host, error) {
+	resp, err := e.get(ctx, "api/edge/data.json?data=dhcp_leases")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	err = checkResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	decodedResp := dhcpLeasesResponse{}
+
+	err = json.NewDecoder(resp.Body).Decode(&decodedResp)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode dhcp leases: %v", err)
+	}
+
+	toReturn, err := e.getStaticHosts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	e.logger.Printf("found %d static mappings on %s", len(toReturn), e.baseURL.Host)
+
+	var leases []provider.Host
+	for network, value := range decodedResp.Output.DHCPServerLeases {
+		for ip, details := range value {
+			leases = append(leases, provider.Host{
+				Name:    details.ClientHostname,
+				IP:      net.ParseIP(ip),
+				MAC:     details.Mac,
+				Network: network,
+			})
+		}
+	}
+	sortHosts(leases)
+	e.logger.Printf("found %d dhcp leases on %s", len(leases), e.baseURL.Host)
+
+	return append(toReturn, leases...), nil
+}
+
+// Check performs a lightweight authenticated API call to verify that the
+// session established at login is usable.
+func (e *Client) Check(ctx context.Context) error {
+	resp, err := e.get(ctx, "api/edge/data.json?data=dhcp_leases")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = checkResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	decodedResp := dhcpLeasesResponse{}
+
+	err = json.NewDecoder(resp.Body).Decode(&decodedResp)
+	if err != nil {
+		return fmt.Errorf("unexpected response, the credentials may be invalid: %v", err)
+	}
+
+	return nil
+}
+
+func (e *Client) getStaticHosts(ctx context.Context) ([]provider.Host, error) {
+	resp, err := e.get(ctx, "api/edge/get.json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	err = checkResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	sharedNetworks, err := decodeSharedNetworks(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode static mappings: %v", err)
+	}
+
+	var toReturn []provider.Host
+	for network, sharedNetwork := range sharedNetworks {
+		for _, subnet := range sharedNetwork.Subnet {
+			for name, staticMapping := range subnet.StaticMapping {
+				toReturn = append(toReturn, provider.Host{
+					Name:    name,
+					IP:      net.ParseIP(staticMapping.IPAddress),
+					MAC:     staticMapping.MACAddress,
+					Static:  true,
+					Network: network,
+				})
+			}
+		}
+	}
+	sortHosts(toReturn)
+
+	return toReturn, nil
+}
+
+// sortHosts sorts hosts by name then IP, so that the order the router's maps
+// are decoded in does not decide which of several hosts with the same name
+// wins.
+func sortHosts(hosts []provider.Host) {
+	sort.Slice(hosts, func(i, j int) bool {
+		if hosts[i].Name != hosts[j].Name {
+			return hosts[i].Name < hosts[j].Name
+		}
+		return bytes.Compare(hosts[i].IP, hosts[j].IP) < 0
+	})
+}
+
+// get requests the API endpoint at ref, relative to the client's base URL.
+func (e *Client) get(ctx context.Context, ref string) (*http.Response, error) {
+	u, err := e.baseURL.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := e.do(ctx, u)
+	if err != nil || !e.resumed {
+		return resp, err
+	}
+
+	e.resumed = false
+	if !sessionRejected(resp) {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	e.logger.Printf("saved session on %s was rejected, logging in again", e.baseURL.Host)
+	err = e.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.do(ctx, u)
+}
+
+// do makes a GET request to u. A new request is needed for every attempt as
+// the client adds the session cookies to it.
+func (e *Client) do(ctx context.Context, u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.httpClient.Do(req)
+}
+
+// sessionRejected reports whether resp shows that the router did not accept
+// the session, either by refusing the request or by serving the login page.
+func sessionRejected(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return true
+	}
+
+	return strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html")
+}
+
+// checkResponse returns an error for an unsuccessful API response, wrapping
+// provider.ErrAuthFailed if the router rejected the session, such as by
+// serving its login page once the session expired, and
+// provider.ErrUnavailable if it failed in a way that may be temporary.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK && sessionRejected(resp) {
+		return fmt.Errorf("%w: served the login page instead of the API response", provider.ErrAuthFailed)
+	}
+
+	return checkStatus(resp)
+}
+
+// checkStatus returns an error for an unsuccessful response status, wrapping
+// the same errors as checkResponse.
+func checkStatus(resp *http.Response) error {
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: %s", provider.ErrAuthFailed, resp.Status)
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return fmt.Errorf("%w: %s", provider.ErrUnavailable, resp.Status)
+	default:
+		return fmt.Errorf("unexpected response status %s", resp.Status)
+	}
+}
+
+// NewClient logs in to the EdgeOS router at address, which may include a
+// port, e.g. "192.168.1.1", "router.lan:8443", or "[fd00::1]:443". Unless an
+// HTTP client or TLS config is given as an option, the router's certificate
+// is not verified as EdgeOS ships with a self-signed one. Given a session
+// store, a saved session is resumed instead, and the client only logs in once
+// the router rejects it.
+func NewClient(address, username, password string, opts ...Option) (*Client, error) {
+	c := config{
+		ctx:     context.Background(),
+		baseURL: baseURLFor(address),
+		logger:  log.New(ioutil.Discard, "", 0),
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+
+	baseURL, err := url.Parse(c.baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %v", err)
+	}
+	if !strings.HasSuffix(baseURL.Path, "/") {
+		baseURL.Path += "/"
+	}
+
+	var client *http.Client
+	if c.httpClient != nil {
+		// Work on a copy so the caller's client is never modified.
+		clone := *c.httpClient
+		client = &clone
+	} else {
+		tlsConfig := c.tlsConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+
+		client = provider.NewHTTPClient(tlsConfig, c.proxy)
+	}
+	if c.transport != nil {
+		client.Transport = c.transport(client.Transport)
+	}
+	if client.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		client.Jar = jar
+	}
+	if c.timeout != 0 {
+		client.Timeout = c.timeout
+	}
+
+	e := &Client{
+		httpClient: client,
+		baseURL:    baseURL,
+		logger:     c.logger,
+		username:   username,
+		password:   password,
+		sessions:   c.sessions,
+	}
+
+	if e.resumeSession() {
+		return e, nil
+	}
+
+	err = e.login(c.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// login logs in to the router, saving the session if there is a session
+// store.
+func (e *Client) login(ctx context.Context) error {
+	v := url.Values{
+		"username": []string{e.username},
+		"password": []string{e.password},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.baseURL.String(), strings.NewReader(v.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := e.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// The dashboard a successful login redirects to is a web page, so only
+	// the status tells whether the request failed.
+	err = checkStatus(res)
+	if err != nil {
+		return err
+	}
+
+	// EdgeOS answers a successful login by setting the session cookie and
+	// redirecting to the dashboard, and a failed one by serving the login
+	// page again.
+	cookies := e.httpClient.Jar.Cookies(e.baseURL)
+	if res.Request.Response == nil || len(cookies) == 0 {
+		return fmt.Errorf("%w: %s rejected the username or password", provider.ErrAuthFailed, e.baseURL.Host)
+	}
+
+	e.logger.Printf("logged in to %s as %s", e.baseURL.Host, e.username)
+
+	if e.sessions != nil {
+		err = e.saveSession(cookies)
+		if err != nil {
+			e.logger.Printf("could not save session on %s: %v", e.baseURL.Host, err)
+		}
+	}
+
+	return nil
+}
+
+// sessionCookie is the form session cookies are saved in.
+type sessionCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// sessionKey identifies the session of the client in the session store.
+func (e *Client) sessionKey() string {
+	return "edgeos " + e.username + " " + e.baseURL.String()
+}
+
+func (e *Client) saveSession(cookies []*http.Cookie) error {
+	saved := make([]sessionCookie, 0, len(cookies))
+	for _, cookie := range cookies {
+		saved = append(saved, sessionCookie{Name: cookie.Name, Value: cookie.Value})
+	}
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return err
+	}
+
+	return e.sessions.Save(e.sessionKey(), e.password, data)
+}
+
+// resumeSession restores the session saved in the session store, if any,
+// reporting whether it did. Whether the router still accepts the session is
+// only known once it is used.
+func (e *Client) resumeSession() bool {
+	if e.sessions == nil {
+		return false
+	}
+
+	data, err := e.sessions.Load(e.sessionKey(), e.password)
+	if err != nil {
+		e.logger.Printf("could not load session on %s: %v", e.baseURL.Host, err)
+		return false
+	}
+	if data == nil {
+		return false
+	}
+
+	var saved []sessionCookie
+	err = json.Unmarshal(data, &saved)
+	if err != nil || len(saved) == 0 {
+		return false
+	}
+
+	cookies := make([]*http.Cookie, 0, len(saved))
+	for _, cookie := range saved {
+		cookies = append(cookies, &http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	e.httpClient.Jar.SetCookies(e.baseURL, cookies)
+	e.resumed = true
+
+	e.logger.Printf("resumed session on %s as %s", e.baseURL.Host, e.username)
+
+	return true
+}
+
+// baseURLFor returns the URL of the web UI of the router at address, a
+// hostname or IP optionally followed by a port. IPv6 literals without a port
+// may be given with or without brackets.
+func baseURLFor(address string) string {
+	host := address
+	if _, _, err := net.SplitHostPort(address); err != nil && strings.Contains(address, ":") {
+		host = "[" + strings.Trim(address, "[]") + "]"
+	}
+
+	return (&url.URL{Scheme: "https", Host: host, Path: "/"}).String()
+}
+
+type edgeOSSharedNetwork struct {
+	Subnet map[string]edgeOSSubnet `json:"subnet"`
+}
+
+type edgeOSSubnet struct {
+	StaticMapping map[string]edgeOSStaticMapping `json:"static-mapping"`
+}
+
+type edgeOSStaticMapping struct {
+	IPAddress  string `json:"ip-address"`
+	MACAddress string `json:"mac-address"`
+}
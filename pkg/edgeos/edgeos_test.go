@@ -0,0 +1,198 @@
+package edgeos
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/hosttest"
+	"github.com/grounded042/dhcp-hosts-updater/pkg/provider"
+)
+
+const leasesResponse = `{
+	"success": "1",
+	"output": {
+		"dhcp-server-leases": {
+			"LAN": {
+				"10.0.0.20": {"expiration": "2026/10/16 10:00:00", "pool": "LAN", "mac": "aa:bb:cc:dd:ee:02", "client-hostname": "laptop"},
+				"10.0.0.21": {"expiration": "2026/10/16 11:00:00", "pool": "LAN", "mac": "aa:bb:cc:dd:ee:03", "client-hostname": "phone"}
+			},
+			"GUEST": ""
+		}
+	}
+}`
+
+const configResponse = `{
+	"GET": {
+		"system": {"host-name": "router"},
+		"service": {
+			"dhcp-server": {
+				"shared-network-name": {
+					"LAN": {
+						"subnet": {
+							"10.0.0.0/24": {
+								"static-mapping": {
+									"nas": {"ip-address": "10.0.0.5", "mac-address": "aa:bb:cc:dd:ee:01"}
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	},
+	"success": true
+}`
+
+// savedSession is a provider.SessionStore holding one session for any key,
+// so that a client resumes it instead of logging in to the test server.
+type savedSession []byte
+
+func (s savedSession) Load(key, secret string) ([]byte, error) {
+	return s, nil
+}
+
+func (s savedSession) Save(key, secret string, session []byte) error {
+	return nil
+}
+
+// newTestClient returns a client of server that resumed a saved session.
+func newTestClient(t *testing.T, server *httptest.Server) *Client {
+	t.Helper()
+
+	client, err := NewClient(server.Listener.Addr().String(), "ubnt", "secret",
+		WithSessionStore(savedSession(`[{"name":"PHPSESSID","value":"abc"}]`)))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	return client
+}
+
+func TestClientGetHosts(t *testing.T) {
+	server := hosttest.NewTLSServer(t, map[string]string{
+		"/api/edge/data.json?data=dhcp_leases": leasesResponse,
+		"/api/edge/get.json":                   configResponse,
+	})
+	defer server.Close()
+
+	hosts, err := newTestClient(t, server).GetHosts(context.Background())
+	if err != nil {
+		t.Fatalf("GetHosts() error = %v", err)
+	}
+
+	got, err := json.MarshalIndent(hosts, "", "\t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hosttest.Golden(t, filepath.Join("testdata", "hosts.golden"), append(got, '\n'))
+}
+
+func TestClientCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses map[string]string
+		wantErr   error
+	}{
+		{
+			name:      "ok",
+			responses: map[string]string{"/api/edge/data.json?data=dhcp_leases": leasesResponse},
+		},
+		{
+			name:      "not found",
+			responses: map[string]string{},
+			wantErr:   errors.New("unexpected response status 404 Not Found"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := hosttest.NewTLSServer(t, tt.responses)
+			defer server.Close()
+
+			err := newTestClient(t, server).Check(context.Background())
+			if (err == nil) != (tt.wantErr == nil) || err != nil && err.Error() != tt.wantErr.Error() {
+				t.Errorf("Check() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewClientRejectedLogin(t *testing.T) {
+	// A failed login serves the login page again instead of redirecting.
+	server := hosttest.NewTLSServer(t, map[string]string{"/": "<html><body>Login</body></html>"})
+	defer server.Close()
+
+	_, err := NewClient(server.Listener.Addr().String(), "ubnt", "wrong")
+	if !errors.Is(err, provider.ErrAuthFailed) {
+		t.Errorf("NewClient() error = %v, want %v", err, provider.ErrAuthFailed)
+	}
+}
+
+func TestNewClientContext(t *testing.T) {
+	server := hosttest.NewTLSServer(t, map[string]string{"/": "<html><body>Login</body></html>"})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := NewClient(server.Listener.Addr().String(), "ubnt", "secret", WithContext(ctx))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("NewClient() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	tests := []struct {
+		status  int
+		wantErr error
+	}{
+		{http.StatusOK, nil},
+		{http.StatusUnauthorized, provider.ErrAuthFailed},
+		{http.StatusForbidden, provider.ErrAuthFailed},
+		{http.StatusTooManyRequests, provider.ErrUnavailable},
+		{http.StatusBadGateway, provider.ErrUnavailable},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Status: http.StatusText(tt.status)}
+		err := checkResponse(resp)
+		if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+			t.Errorf("checkResponse(%d) = %v, want %v", tt.status, err, tt.wantErr)
+		}
+	}
+
+	if err := checkResponse(&http.Response{StatusCode: http.StatusNotFound, Status: "404 Not Found"}); err == nil {
+		t.Errorf("checkResponse(404) = nil, want an error")
+	}
+
+	// An expired session gets the login page rather than an error status.
+	loginPage := &http.Response{
+		StatusCode: http.StatusOK,
+		Status:     "200 OK",
+		Header:     http.Header{"Content-Type": []string{"text/html; charset=utf-8"}},
+	}
+	if err := checkResponse(loginPage); !errors.Is(err, provider.ErrAuthFailed) {
+		t.Errorf("checkResponse(200 text/html) = %v, want %v", err, provider.ErrAuthFailed)
+	}
+}
+
+func TestBaseURLFor(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"192.168.1.1", "https://192.168.1.1/"},
+		{"router.lan:8443", "https://router.lan:8443/"},
+		{"[fd00::1]:443", "https://[fd00::1]:443/"},
+		{"fd00::1", "https://[fd00::1]/"},
+		{"[fd00::1]", "https://[fd00::1]/"},
+	}
+	for _, tt := range tests {
+		if got := baseURLFor(tt.address); got != tt.want {
+			t.Errorf("baseURLFor(%q) = %q, want %q", tt.address, got, tt.want)
+		}
+	}
+}
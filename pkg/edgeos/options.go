@@ -0,0 +1,107 @@
+package edgeos
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/provider"
+)
+
+// config collects the options passed to NewClient.
+type config struct {
+	ctx        context.Context
+	baseURL    string
+	httpClient *http.Client
+	transport  func(http.RoundTripper) http.RoundTripper
+	tlsConfig  *tls.Config
+	proxy      *url.URL
+	timeout    time.Duration
+	logger     *log.Logger
+	sessions   provider.SessionStore
+}
+
+// Option configures a Client created by NewClient.
+type Option func(*config)
+
+// WithContext sets the context bounding the login NewClient performs. By
+// default it is context.Background().
+func WithContext(ctx context.Context) Option {
+	return func(c *config) {
+		c.ctx = ctx
+	}
+}
+
+// WithBaseURL sets the URL the router's web UI is served from, for routers
+// behind a nonstandard port or path, e.g. "https://router.lan:8443/edge/". By
+// default it is built from the address passed to NewClient.
+func WithBaseURL(baseURL string) Option {
+	return func(c *config) {
+		c.baseURL = baseURL
+	}
+}
+
+// WithHTTPClient sets the HTTP client requests are made with. The client is
+// copied rather than modified. The copy gets its own cookie jar to hold the
+// login session unless the client already has one, and the timeout given by
+// WithTimeout, if any.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *config) {
+		c.httpClient = client
+	}
+}
+
+// WithTransport sets a function wrapping the transport of the client's HTTP
+// client, e.g. provider.RateLimiter.Transport. Every request goes through
+// it, including the login.
+func WithTransport(wrap func(http.RoundTripper) http.RoundTripper) Option {
+	return func(c *config) {
+		c.transport = wrap
+	}
+}
+
+// WithTLSConfig sets the TLS config used to connect to the router, e.g. to
+// verify its certificate against a private CA. It is ignored when
+// WithHTTPClient is also given.
+func WithTLSConfig(tlsConfig *tls.Config) Option {
+	return func(c *config) {
+		c.tlsConfig = tlsConfig
+	}
+}
+
+// WithProxy sets the proxy used to connect to the router. By default the
+// proxy environment variables are honored. It is ignored when WithHTTPClient
+// is also given.
+func WithProxy(proxy *url.URL) Option {
+	return func(c *config) {
+		c.proxy = proxy
+	}
+}
+
+// WithTimeout bounds every request made to the router, including the login.
+// The default client times out after provider.DefaultRequestTimeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *config) {
+		c.timeout = timeout
+	}
+}
+
+// WithLogger sets the logger the client logs to. By default nothing is
+// logged.
+func WithLogger(logger *log.Logger) Option {
+	return func(c *config) {
+		c.logger = logger
+	}
+}
+
+// WithSessionStore sets where the client keeps its login session, encrypted
+// with the password, so that later clients for the same router and user can
+// resume it instead of logging in.
+func WithSessionStore(store provider.SessionStore) Option {
+	return func(c *config) {
+		c.sessions = store
+	}
+}
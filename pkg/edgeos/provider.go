@@ -0,0 +1,31 @@
+package edgeos
+
+import (
+	"github.com/grounded042/dhcp-hosts-updater/pkg/provider"
+)
+
+func init() {
+	provider.Register(provider.Definition{
+		Name: "edgeos",
+		Flags: map[string]string{
+			"address":  "address of the EdgeOS router with an optional port, e.g. 192.168.1.1, router.lan:8443, or [fd00::1]:443",
+			"username": "EdgeOS username",
+			"password": "EdgeOS password",
+		},
+		RequiredFlags: []string{"address", "username", "password"},
+		New:           newHostsProvider,
+	})
+}
+
+// newHostsProvider creates a Client from the provider's flags.
+func newHostsProvider(flags map[string]string, opts provider.Options) (provider.HostsProvider, error) {
+	clientOpts := []Option{WithContext(opts.Context), WithLogger(opts.Logger), WithProxy(opts.Proxy), WithSessionStore(opts.Sessions)}
+	if opts.Transport != nil {
+		clientOpts = append(clientOpts, WithTransport(opts.Transport))
+	}
+	if opts.HTTPClient != nil {
+		clientOpts = append(clientOpts, WithHTTPClient(opts.HTTPClient()))
+	}
+
+	return NewClient(flags["address"], flags["username"], flags["password"], clientOpts...)
+}
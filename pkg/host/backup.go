@@ -0,0 +1,95 @@
+package host
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/grounded042/dhcp-hosts-updater/internal/atomicfile"
+)
+
+// backupTimeFormat is fixed width so that backups sort chronologically when
+// sorted by name.
+const backupTimeFormat = "20060102T150405.000000"
+
+// backupHostsFile copies the hosts file at path to a timestamped backup next to
+// it and then removes all but the newest retain backups. A retain of zero or
+// less disables backups.
+func backupHostsFile(path string, retain int) error {
+	if retain <= 0 {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	backupPath := fmt.Sprintf("%s.%s.bak", path, time.Now().Format(backupTimeFormat))
+	err = ioutil.WriteFile(backupPath, data, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	backups, err := listBackups(path)
+	if err != nil {
+		return err
+	}
+
+	for len(backups) > retain {
+		err = os.Remove(backups[0])
+		if err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+// Rollback restores the hosts file at path from its newest backup and returns
+// the path of the backup it used. The backup is removed once restored so that
+// repeated rollbacks walk further back in time.
+func Rollback(path string) (string, error) {
+	backups, err := listBackups(path)
+	if err != nil {
+		return "", err
+	}
+
+	if len(backups) == 0 {
+		return "", fmt.Errorf("no backups of %s found", path)
+	}
+
+	latest := backups[len(backups)-1]
+	data, err := ioutil.ReadFile(latest)
+	if err != nil {
+		return "", err
+	}
+
+	err = atomicfile.WriteFile(path, data, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	return latest, os.Remove(latest)
+}
+
+// listBackups returns the backups of the hosts file at path, oldest first.
+func listBackups(path string) ([]string, error) {
+	backups, err := filepath.Glob(path + ".*.bak")
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(backups)
+
+	return backups, nil
+}
@@ -0,0 +1,103 @@
+package host
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/grounded042/dhcp-hosts-updater/internal/atomicfile"
+	"github.com/grounded042/dhcp-hosts-updater/pkg/provider"
+)
+
+// CacheEntry is the last set of hosts successfully fetched from a provider.
+type CacheEntry struct {
+	FetchedAt time.Time       `json:"fetched_at"`
+	Hosts     []provider.Host `json:"hosts"`
+}
+
+// Cache stores the last hosts successfully fetched from each provider so the
+// Updater can fall back to them while a provider is unreachable.
+type Cache interface {
+	// Get returns the entry stored for provider, if any.
+	Get(provider string) (CacheEntry, bool, error)
+	// Put replaces the entry stored for provider.
+	Put(provider string, entry CacheEntry) error
+}
+
+// MemoryCache is a Cache held in memory, suited to long running processes.
+// The zero value is ready to use.
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]CacheEntry
+}
+
+// Get implements Cache.
+func (c *MemoryCache) Get(provider string) (CacheEntry, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[provider]
+	return entry, ok, nil
+}
+
+// Put implements Cache.
+func (c *MemoryCache) Put(provider string, entry CacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = map[string]CacheEntry{}
+	}
+	c.entries[provider] = entry
+
+	return nil
+}
+
+// FileCache is a Cache that stores each provider's entry as a JSON file in
+// Dir, so it survives between one-shot runs. Dir is created when first
+// written to.
+type FileCache struct {
+	Dir string
+}
+
+// Get implements Cache.
+func (c *FileCache) Get(provider string) (CacheEntry, bool, error) {
+	data, err := ioutil.ReadFile(c.path(provider))
+	if os.IsNotExist(err) {
+		return CacheEntry{}, false, nil
+	}
+	if err != nil {
+		return CacheEntry{}, false, err
+	}
+
+	entry := CacheEntry{}
+	err = json.Unmarshal(data, &entry)
+	if err != nil {
+		return CacheEntry{}, false, err
+	}
+
+	return entry, true, nil
+}
+
+// Put implements Cache. The entry is replaced atomically so a failed write
+// never leaves a truncated entry behind.
+func (c *FileCache) Put(provider string, entry CacheEntry) error {
+	err := os.MkdirAll(c.Dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(c.path(provider), data, 0600)
+}
+
+func (c *FileCache) path(provider string) string {
+	return filepath.Join(c.Dir, provider+".json")
+}
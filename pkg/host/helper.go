@@ -0,0 +1,151 @@
+package host
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+)
+
+// HelperSink is a Sink that has a helper command apply the desired hosts, so
+// that the process fetching them, which holds the provider credentials and
+// talks to the network, needs no rights to write the hosts file. The helper,
+// typically this program's apply command run through sudo or pkexec, reads
+// the desired hosts as JSON on stdin and prints the changes it made as JSON
+// on stdout, as ServeHelper does.
+type HelperSink struct {
+	// Command is the helper command and its arguments.
+	Command []string
+	// Path is the location of the hosts file the helper writes, used to
+	// name the sink in errors.
+	Path string
+}
+
+// String returns the path of the hosts file the helper writes.
+func (s *HelperSink) String() string {
+	return s.Path
+}
+
+// Apply implements Sink.
+func (s *HelperSink) Apply(ctx context.Context, desired []Host) (ChangeSet, error) {
+	request, err := json.Marshal(helperRequest{Hosts: toHelperHosts(desired)})
+	if err != nil {
+		return ChangeSet{}, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.Command[0], s.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return ChangeSet{}, fmt.Errorf("write helper failed: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	var response helperResponse
+	err = json.Unmarshal(stdout.Bytes(), &response)
+	if err != nil {
+		return ChangeSet{}, fmt.Errorf("invalid write helper output: %v", err)
+	}
+
+	return response.changeSet(), nil
+}
+
+// ServeHelper is the other end of a HelperSink. It reads the desired hosts
+// from r, drops those Validate rejects, applies the rest to sink, and writes
+// the changes made to w before returning them.
+func ServeHelper(ctx context.Context, r io.Reader, w io.Writer, sink Sink, invalid func(h Host, reason string)) (ChangeSet, error) {
+	var request helperRequest
+	err := json.NewDecoder(r).Decode(&request)
+	if err != nil {
+		return ChangeSet{}, fmt.Errorf("invalid request: %v", err)
+	}
+
+	desired := fromHelperHosts(request.Hosts)
+	desired = Validate(invalid).Transform(Sanitize.Transform(desired))
+
+	changes, err := sink.Apply(ctx, desired)
+	if err != nil {
+		return ChangeSet{}, err
+	}
+
+	return changes, json.NewEncoder(w).Encode(newHelperResponse(changes))
+}
+
+// helperRequest is the JSON a HelperSink sends its helper.
+type helperRequest struct {
+	Hosts []helperHost `json:"hosts"`
+}
+
+// helperResponse is the JSON a helper replies with.
+type helperResponse struct {
+	Changes   []helperChange `json:"changes"`
+	Unchanged []helperHost   `json:"unchanged"`
+}
+
+type helperChange struct {
+	Action Action     `json:"action"`
+	Host   helperHost `json:"host"`
+	OldIP  net.IP     `json:"old_ip,omitempty"`
+}
+
+type helperHost struct {
+	Name     string `json:"name"`
+	IP       net.IP `json:"ip"`
+	MAC      string `json:"mac,omitempty"`
+	Static   bool   `json:"static,omitempty"`
+	Provider string `json:"provider,omitempty"`
+}
+
+func newHelperResponse(changes ChangeSet) helperResponse {
+	response := helperResponse{
+		Changes:   make([]helperChange, 0, len(changes.Changes)),
+		Unchanged: toHelperHosts(changes.Unchanged),
+	}
+	for _, c := range changes.Changes {
+		response.Changes = append(response.Changes, helperChange{
+			Action: c.Action,
+			Host:   helperHost(c.Host),
+			OldIP:  c.OldIP,
+		})
+	}
+
+	return response
+}
+
+func (r helperResponse) changeSet() ChangeSet {
+	var changes ChangeSet
+	for _, c := range r.Changes {
+		changes.Changes = append(changes.Changes, Change{
+			Action: c.Action,
+			Host:   Host(c.Host),
+			OldIP:  c.OldIP,
+		})
+	}
+	changes.Unchanged = fromHelperHosts(r.Unchanged)
+
+	return changes
+}
+
+func toHelperHosts(hosts []Host) []helperHost {
+	converted := make([]helperHost, 0, len(hosts))
+	for _, h := range hosts {
+		converted = append(converted, helperHost(h))
+	}
+
+	return converted
+}
+
+func fromHelperHosts(hosts []helperHost) []Host {
+	converted := make([]Host, 0, len(hosts))
+	for _, h := range hosts {
+		converted = append(converted, Host(h))
+	}
+
+	return converted
+}
@@ -0,0 +1,74 @@
+// Package host defines the hosts passed from providers to sinks, the sinks
+// that hosts can be written to, and the Updater that transforms hosts on their
+// way from one to the other.
+package host
+
+import (
+	"context"
+	"net"
+)
+
+// Host is a hostname and the IP it should resolve to.
+type Host struct {
+	Name string
+	IP   net.IP
+	// MAC is the hardware address of the host in the form produced by
+	// net.HardwareAddr, empty if the provider did not report one.
+	MAC string
+	// Static is set for hosts the provider reported as having a fixed
+	// address.
+	Static bool
+	// Provider names the provider that reported the host, empty for hosts
+	// read from a sink.
+	Provider string
+}
+
+// Action is the kind of modification a Change made.
+type Action string
+
+// The actions a Sink can take to reach the desired hosts.
+const (
+	ActionAdd    Action = "add"
+	ActionRemove Action = "remove"
+	ActionUpdate Action = "update"
+)
+
+// Change describes a single modification made by a Sink. OldIP is only set for
+// updates.
+type Change struct {
+	Action Action
+	Host   Host
+	OldIP  net.IP
+}
+
+// ChangeSet is the set of changes a Sink made, or would need to make, to
+// reach the desired hosts.
+type ChangeSet struct {
+	Changes []Change
+	// Unchanged lists the desired hosts that were already present.
+	Unchanged []Host
+}
+
+// Empty reports whether the change set contains no changes.
+func (c ChangeSet) Empty() bool {
+	return len(c.Changes) == 0
+}
+
+// Count returns the number of changes with the given action.
+func (c ChangeSet) Count(action Action) int {
+	count := 0
+	for _, change := range c.Changes {
+		if change.Action == action {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Sink is a destination for hosts, such as a hosts file.
+type Sink interface {
+	// Apply makes the sink contain the desired hosts and returns the changes
+	// it had to make to do so.
+	Apply(ctx context.Context, desired []Host) (ChangeSet, error)
+}
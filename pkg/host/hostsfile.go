@@ -0,0 +1,164 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+
+	"github.com/grounded042/dhcp-hosts-updater/internal/atomicfile"
+	"github.com/grounded042/dhcp-hosts-updater/pkg/hosts"
+)
+
+// ErrHostsParse is wrapped by the errors returned when the hosts file could
+// not be parsed, as opposed to opened or written.
+var ErrHostsParse = errors.New("could not parse hosts file")
+
+// HostsFile is a Sink that writes hosts to a hosts file such as /etc/hosts.
+// Entries for other hostnames are left alone unless they share an IP with a
+// desired host, in which case they are removed. Only the lines holding
+// changed entries are rewritten, and added hosts are appended to the file.
+type HostsFile struct {
+	// Path is the location of the hosts file.
+	Path string
+	// BackupRetention is the number of timestamped backups of the hosts file
+	// to keep. Zero disables backups.
+	BackupRetention int
+	// DryRun makes Apply return the changes it would make without writing
+	// the hosts file or backing it up.
+	DryRun bool
+}
+
+// NewHostsFile returns a HostsFile sink for the system hosts file, which is
+// either $HOSTESS_PATH or the OS default.
+func NewHostsFile() *HostsFile {
+	return &HostsFile{Path: hosts.DefaultPath()}
+}
+
+// String returns the path of the hosts file.
+func (f *HostsFile) String() string {
+	return f.Path
+}
+
+// Preflight checks that Apply will be able to read the hosts file and, unless
+// DryRun is set, replace it, so that a run can fail before any network work
+// is done. The error says how to gain the rights needed.
+func (f *HostsFile) Preflight() error {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return err
+	}
+	file.Close()
+
+	if f.DryRun {
+		return nil
+	}
+
+	err = atomicfile.CheckWritable(f.Path)
+	if err != nil {
+		return fmt.Errorf("cannot write %s (%w), run as %s", f.Path, err, privilegedUser())
+	}
+
+	return nil
+}
+
+// privilegedUser names the user able to write the system hosts file.
+func privilegedUser() string {
+	if runtime.GOOS == "windows" {
+		return "Administrator"
+	}
+
+	return "root, e.g. with sudo"
+}
+
+// Apply implements Sink. The hosts file is only written, and backed up, if it
+// needs changing.
+func (f *HostsFile) Apply(ctx context.Context, desired []Host) (ChangeSet, error) {
+	file, entries, err := f.read()
+	if err != nil {
+		return ChangeSet{}, err
+	}
+
+	r := newReconciler(entriesOf(entries))
+	var changes ChangeSet
+	for _, h := range desired {
+		r.reconcile(h, &changes)
+	}
+	if changes.Empty() || f.DryRun {
+		return changes, nil
+	}
+
+	// The entries of the reconciler line up with the entries parsed from
+	// the file, followed by the ones it added.
+	for i, e := range r.entries {
+		if i >= len(entries) {
+			// An added entry may have been taken over by a later
+			// desired host.
+			if !r.removed[i] {
+				file.Add(e.Name, e.IP)
+			}
+			continue
+		}
+
+		entry := entries[i]
+		switch {
+		case r.removed[i]:
+			file.Remove(entry)
+			continue
+		case !entry.IP.Equal(e.IP):
+			entry = file.SetIP(entry, e.IP)
+		}
+		if !entry.Enabled && !e.Disabled {
+			file.Enable(entry)
+		}
+	}
+
+	err = backupHostsFile(f.Path, f.BackupRetention)
+	if err != nil {
+		return ChangeSet{}, fmt.Errorf("could not back up hosts file: %v", err)
+	}
+
+	return changes, atomicfile.WriteFile(f.Path, file.Bytes(), 0644)
+}
+
+// Check returns the changes Apply would make to reach the desired hosts
+// without writing the hosts file, regardless of DryRun. After a successful
+// Apply it is empty until something else edits the file.
+func (f *HostsFile) Check(ctx context.Context, desired []Host) (ChangeSet, error) {
+	_, entries, err := f.read()
+	if err != nil {
+		return ChangeSet{}, err
+	}
+
+	return Reconcile(entriesOf(entries), desired), nil
+}
+
+// read parses the hosts file, returning it along with its entries.
+func (f *HostsFile) read() (*hosts.File, []*hosts.Entry, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	parsed, err := hosts.Parse(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w %s: %v", ErrHostsParse, f.Path, err)
+	}
+
+	return parsed, parsed.Entries(), nil
+}
+
+// entriesOf converts the entries of a hosts file for Reconcile.
+func entriesOf(entries []*hosts.Entry) []Entry {
+	current := make([]Entry, 0, len(entries))
+	for _, e := range entries {
+		current = append(current, Entry{
+			Host:     Host{Name: e.Name, IP: e.IP},
+			Disabled: !e.Enabled,
+		})
+	}
+
+	return current
+}
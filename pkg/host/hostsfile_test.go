@@ -0,0 +1,30 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestHostsFileParseError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hostsfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A directory opens fine but cannot be read as a hosts file.
+	f := &HostsFile{Path: dir}
+	_, err = f.Check(context.Background(), nil)
+	if !errors.Is(err, ErrHostsParse) {
+		t.Errorf("Check() error = %v, want %v", err, ErrHostsParse)
+	}
+
+	f.Path = dir + "/missing"
+	_, err = f.Check(context.Background(), nil)
+	if !os.IsNotExist(err) || errors.Is(err, ErrHostsParse) {
+		t.Errorf("Check() of a missing file error = %v, want a not exist error", err)
+	}
+}
@@ -0,0 +1,106 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// MultiSink is a Sink applying the desired hosts to several sinks
+// concurrently, so that each added sink does not make an update take longer.
+// The first sink is the primary one, whose changes Apply reports.
+type MultiSink struct {
+	Sinks []Sink
+	// Parallelism is the maximum number of sinks applied at once. Zero or
+	// less applies all of them at once.
+	Parallelism int
+}
+
+// Apply implements Sink. It returns the changes made to the first sink. The
+// failures of any sink are reported together in a *SinkError, along with the
+// changes of the first sink if it succeeded.
+func (m *MultiSink) Apply(ctx context.Context, desired []Host) (ChangeSet, error) {
+	if len(m.Sinks) == 0 {
+		return ChangeSet{}, nil
+	}
+
+	type result struct {
+		changes ChangeSet
+		err     error
+	}
+	results := make([]result, len(m.Sinks))
+
+	parallelism := m.Parallelism
+	if parallelism <= 0 || parallelism > len(m.Sinks) {
+		parallelism = len(m.Sinks)
+	}
+	slots := make(chan struct{}, parallelism)
+
+	var wg sync.WaitGroup
+	for i, sink := range m.Sinks {
+		wg.Add(1)
+		go func(i int, sink Sink) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			changes, err := sink.Apply(ctx, desired)
+			results[i] = result{changes: changes, err: err}
+		}(i, sink)
+	}
+	wg.Wait()
+
+	sinkErr := &SinkError{}
+	for i, r := range results {
+		if r.err != nil {
+			sinkErr.Errors = append(sinkErr.Errors, fmt.Errorf("%s: %w", sinkName(m.Sinks[i], i), r.err))
+		}
+	}
+	if len(sinkErr.Errors) == 0 {
+		return results[0].changes, nil
+	}
+
+	if results[0].err != nil {
+		return ChangeSet{}, sinkErr
+	}
+	sinkErr.PrimaryApplied = true
+
+	return results[0].changes, sinkErr
+}
+
+// sinkName names the sink at index i of a MultiSink in errors.
+func sinkName(sink Sink, i int) string {
+	if s, ok := sink.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	return fmt.Sprintf("sink %d", i)
+}
+
+// SinkError reports the sinks of a MultiSink that failed, in the order of
+// its sinks.
+type SinkError struct {
+	Errors []error
+	// PrimaryApplied is set when the first sink succeeded, so that its
+	// changes were made and returned.
+	PrimaryApplied bool
+}
+
+func (e *SinkError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the error of the first sink that failed.
+func (e *SinkError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	return e.Errors[0]
+}
@@ -0,0 +1,164 @@
+package host
+
+import (
+	"net"
+	"sort"
+	"strings"
+)
+
+// Entry is a mapping already present in a sink. Disabled entries, such as
+// commented out lines in a hosts file, are still considered by Reconcile.
+type Entry struct {
+	Host
+	Disabled bool
+}
+
+// Reconcile computes the changes needed for current to contain the desired
+// hosts, without modifying either. Desired hosts are considered in order:
+//
+//   - entries sharing a desired host's IP under a different hostname are
+//     removed, as the IP now belongs to the desired host
+//   - an entry with the desired hostname and IP is kept, and enabled if it
+//     was disabled
+//   - otherwise the first entry with the desired hostname and the same IP
+//     version is updated to the desired IP and any further ones are removed,
+//     or the desired host is added
+//
+// Hostnames are compared case insensitively.
+//
+// Entries for hostnames that are not desired are otherwise left alone.
+// Desired hosts that need no change are listed in the ChangeSet's Unchanged.
+func Reconcile(current []Entry, desired []Host) ChangeSet {
+	r := newReconciler(current)
+
+	var changes ChangeSet
+	for _, h := range desired {
+		r.reconcile(h, &changes)
+	}
+
+	return changes
+}
+
+// reconciler holds the entries of a sink as Reconcile modifies them, indexed
+// by IP and by hostname so that each desired host only looks at the entries
+// it can affect rather than at all of them.
+type reconciler struct {
+	// entries starts out as the current entries, in order, and has the
+	// added entries appended. Removed entries stay in place, marked in
+	// removed, so that indexes remain valid.
+	entries []Entry
+	removed []bool
+	// byIP and byName list the indexes of the entries that are not removed,
+	// in increasing order, keyed by IP string and lowercased hostname, as
+	// hostnames are case insensitive.
+	byIP   map[string][]int
+	byName map[string][]int
+}
+
+func newReconciler(current []Entry) *reconciler {
+	r := &reconciler{
+		entries: append([]Entry(nil), current...),
+		removed: make([]bool, len(current)),
+		byIP:    make(map[string][]int, len(current)),
+		byName:  make(map[string][]int, len(current)),
+	}
+	for i, e := range r.entries {
+		r.byIP[e.IP.String()] = append(r.byIP[e.IP.String()], i)
+		name := strings.ToLower(e.Name)
+		r.byName[name] = append(r.byName[name], i)
+	}
+
+	return r
+}
+
+// reconcile makes the entries contain h, recording the changes needed in
+// changes.
+func (r *reconciler) reconcile(h Host, changes *ChangeSet) {
+	ip := h.IP.String()
+	name := strings.ToLower(h.Name)
+
+	found := false
+	var remaining []int
+	for _, i := range r.byIP[ip] {
+		e := &r.entries[i]
+		if !strings.EqualFold(e.Name, h.Name) {
+			changes.Changes = append(changes.Changes, Change{Action: ActionRemove, Host: e.Host})
+			r.removed[i] = true
+			other := strings.ToLower(e.Name)
+			r.byName[other] = without(r.byName[other], i)
+			continue
+		}
+
+		found = true
+		if e.Disabled {
+			e.Disabled = false
+			changes.Changes = append(changes.Changes, Change{Action: ActionAdd, Host: h})
+		} else {
+			changes.Unchanged = append(changes.Unchanged, h)
+		}
+		remaining = append(remaining, i)
+	}
+	r.byIP[ip] = remaining
+
+	if found {
+		return
+	}
+
+	updated := false
+	for _, i := range r.byName[name] {
+		e := &r.entries[i]
+		if isIPv6(e.IP) != isIPv6(h.IP) {
+			continue
+		}
+
+		// Further entries for the hostname would keep resolving it to
+		// their old IPs.
+		if updated {
+			changes.Changes = append(changes.Changes, Change{Action: ActionRemove, Host: e.Host})
+			r.removed[i] = true
+			r.byIP[e.IP.String()] = without(r.byIP[e.IP.String()], i)
+			r.byName[name] = without(r.byName[name], i)
+			continue
+		}
+
+		updated = true
+		changes.Changes = append(changes.Changes, Change{Action: ActionUpdate, Host: h, OldIP: e.IP})
+		r.byIP[e.IP.String()] = without(r.byIP[e.IP.String()], i)
+		r.byIP[ip] = withSorted(r.byIP[ip], i)
+		*e = Entry{Host: h}
+	}
+
+	if !updated {
+		i := len(r.entries)
+		r.entries = append(r.entries, Entry{Host: h})
+		r.removed = append(r.removed, false)
+		r.byIP[ip] = append(r.byIP[ip], i)
+		r.byName[name] = append(r.byName[name], i)
+		changes.Changes = append(changes.Changes, Change{Action: ActionAdd, Host: h})
+	}
+}
+
+// without returns indexes without i.
+func without(indexes []int, i int) []int {
+	for j, index := range indexes {
+		if index == i {
+			return append(indexes[:j:j], indexes[j+1:]...)
+		}
+	}
+
+	return indexes
+}
+
+// withSorted returns the sorted indexes with i inserted in order.
+func withSorted(indexes []int, i int) []int {
+	j := sort.SearchInts(indexes, i)
+	indexes = append(indexes, 0)
+	copy(indexes[j+1:], indexes[j:])
+	indexes[j] = i
+
+	return indexes
+}
+
+func isIPv6(ip net.IP) bool {
+	return ip.To4() == nil
+}
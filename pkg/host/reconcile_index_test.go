@@ -0,0 +1,287 @@
+package host
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// reconcileLinear is the reconciliation Reconcile did before it indexed the
+// entries, scanning all of them for every desired host. The indexed version
+// must compute the same changes. It also returns the entries the changes
+// leave, in order.
+func reconcileLinear(current []Entry, desired []Host) (ChangeSet, []Entry) {
+	entries := append([]Entry(nil), current...)
+
+	var changes ChangeSet
+	for _, h := range desired {
+		found := false
+		remaining := entries[:0:0]
+		for _, e := range entries {
+			switch {
+			case !e.IP.Equal(h.IP):
+			case strings.EqualFold(e.Name, h.Name):
+				found = true
+				if e.Disabled {
+					e.Disabled = false
+					changes.Changes = append(changes.Changes, Change{Action: ActionAdd, Host: h})
+				} else {
+					changes.Unchanged = append(changes.Unchanged, h)
+				}
+			default:
+				changes.Changes = append(changes.Changes, Change{Action: ActionRemove, Host: e.Host})
+				continue
+			}
+
+			remaining = append(remaining, e)
+		}
+		entries = remaining
+
+		if found {
+			continue
+		}
+
+		change := Change{Action: ActionAdd, Host: h}
+		var removed []Change
+		remaining = entries[:0:0]
+		for _, e := range entries {
+			if strings.EqualFold(e.Name, h.Name) && isIPv6(e.IP) == isIPv6(h.IP) {
+				if change.Action == ActionUpdate {
+					removed = append(removed, Change{Action: ActionRemove, Host: e.Host})
+					continue
+				}
+				change.Action = ActionUpdate
+				change.OldIP = e.IP
+				e = Entry{Host: h}
+			}
+
+			remaining = append(remaining, e)
+		}
+		entries = remaining
+
+		if change.Action == ActionAdd {
+			entries = append(entries, Entry{Host: h})
+		}
+
+		changes.Changes = append(changes.Changes, change)
+		changes.Changes = append(changes.Changes, removed...)
+	}
+
+	return changes, entries
+}
+
+func TestReconcileMatchesLinear(t *testing.T) {
+	tests := []struct {
+		name    string
+		current []Entry
+		desired []Host
+	}{
+		{
+			name:    "removals before the update they make room for",
+			current: []Entry{entry("printer", "10.0.0.5"), entry("nas", "10.0.0.6"), entry("tv", "10.0.0.7")},
+			desired: []Host{hostOf("nas", "10.0.0.5"), hostOf("tv", "10.0.0.6")},
+		},
+		{
+			name:    "update then takeover of the old IP",
+			current: []Entry{entry("nas", "10.0.0.5"), entry("printer", "10.0.0.6")},
+			desired: []Host{hostOf("nas", "10.0.0.7"), hostOf("printer", "10.0.0.5")},
+		},
+		{
+			name:    "takeover of an updated host's new IP",
+			current: []Entry{entry("nas", "10.0.0.5")},
+			desired: []Host{hostOf("nas", "10.0.0.7"), hostOf("tv", "10.0.0.7")},
+		},
+		{
+			name:    "re-enable disabled entry",
+			current: []Entry{disabled("nas", "10.0.0.5"), entry("tv", "10.0.0.7")},
+			desired: []Host{hostOf("nas", "10.0.0.5"), hostOf("tv", "10.0.0.7")},
+		},
+		{
+			name:    "disabled entry updated",
+			current: []Entry{disabled("nas", "10.0.0.5")},
+			desired: []Host{hostOf("nas", "10.0.0.9")},
+		},
+		{
+			name:    "disabled entry taken over",
+			current: []Entry{disabled("printer", "10.0.0.5")},
+			desired: []Host{hostOf("nas", "10.0.0.5")},
+		},
+		{
+			name:    "duplicate IPs in the file",
+			current: []Entry{entry("nas", "10.0.0.5"), entry("nas-alias", "10.0.0.5"), entry("printer", "10.0.0.5")},
+			desired: []Host{hostOf("nas", "10.0.0.5")},
+		},
+		{
+			name:    "duplicate IPs among desired hosts",
+			current: []Entry{entry("router", "10.0.0.1")},
+			desired: []Host{hostOf("nas", "10.0.0.5"), hostOf("tv", "10.0.0.5"), hostOf("nas", "10.0.0.5")},
+		},
+		{
+			name:    "duplicate names in the file",
+			current: []Entry{disabled("nas", "10.0.0.5"), entry("nas", "10.0.0.6"), entry("NAS", "fd00::5")},
+			desired: []Host{hostOf("nas", "10.0.0.7"), hostOf("nas", "fd00::7")},
+		},
+		{
+			name:    "duplicate names of one IP version",
+			current: []Entry{entry("nas", "10.0.0.5"), entry("NAS", "10.0.0.6"), disabled("nas", "10.0.0.8"), entry("nas", "10.0.0.9")},
+			desired: []Host{hostOf("nas", "10.0.0.7")},
+		},
+		{
+			name:    "duplicate names with a takeover",
+			current: []Entry{entry("nas", "10.0.0.5"), entry("nas", "10.0.0.6"), entry("tv", "10.0.0.7")},
+			desired: []Host{hostOf("tv", "10.0.0.6"), hostOf("nas", "10.0.0.7")},
+		},
+		{
+			name:    "mixed case",
+			current: []Entry{entry("NAS", "10.0.0.5"), entry("Printer", "10.0.0.6")},
+			desired: []Host{hostOf("nas", "10.0.0.6"), hostOf("printer", "10.0.0.5")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, _ := reconcileLinear(tt.current, tt.desired)
+			got := Reconcile(tt.current, tt.desired)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Reconcile() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestReconcileMatchesLinearRandom(t *testing.T) {
+	// Few names and IPs, so that hosts collide often.
+	names := []string{"nas", "NAS", "tv", "printer", "laptop"}
+	ips := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4", "fd00::1", "fd00::2"}
+
+	rng := rand.New(rand.NewSource(1))
+	for n := 0; n < 1000; n++ {
+		var current []Entry
+		for i := rng.Intn(8); i > 0; i-- {
+			e := entry(names[rng.Intn(len(names))], ips[rng.Intn(len(ips))])
+			e.Disabled = rng.Intn(4) == 0
+			current = append(current, e)
+		}
+		var desired []Host
+		for i := rng.Intn(6); i > 0; i-- {
+			desired = append(desired, hostOf(names[rng.Intn(len(names))], ips[rng.Intn(len(ips))]))
+		}
+
+		want, _ := reconcileLinear(current, desired)
+		got := Reconcile(current, desired)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Reconcile(%s, %s) = %+v, want %+v", formatEntries(current), formatHosts(desired), got, want)
+		}
+	}
+}
+
+// TestHostsFileApplyMatchesLinear checks that applying only the changed
+// entries to a hosts file leaves the entries the linear reconciliation ends
+// up with.
+func TestHostsFileApplyMatchesLinear(t *testing.T) {
+	names := []string{"nas", "NAS", "tv", "printer"}
+	ips := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "fd00::1"}
+
+	dir, err := ioutil.TempDir("", "reconcile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	f := &HostsFile{Path: filepath.Join(dir, "hosts")}
+
+	// Duplicate names, which an update collapses into one entry.
+	checkApplyMatchesLinear(t, f,
+		[]Entry{entry("nas", "10.0.0.1"), entry("tv", "10.0.0.3"), entry("NAS", "10.0.0.2"), disabled("nas", "10.0.0.3")},
+		[]Host{hostOf("nas", "10.0.0.4")})
+	checkApplyMatchesLinear(t, f,
+		[]Entry{entry("nas", "10.0.0.1"), entry("NAS", "10.0.0.2"), entry("nas", "fd00::1")},
+		[]Host{hostOf("nas", "10.0.0.3")})
+
+	rng := rand.New(rand.NewSource(1))
+	for n := 0; n < 300; n++ {
+		var current []Entry
+		for i := rng.Intn(6); i > 0; i-- {
+			e := entry(names[rng.Intn(len(names))], ips[rng.Intn(len(ips))])
+			e.Disabled = rng.Intn(4) == 0
+			current = append(current, e)
+		}
+		var desired []Host
+		for i := rng.Intn(5); i > 0; i-- {
+			desired = append(desired, hostOf(names[rng.Intn(len(names))], ips[rng.Intn(len(ips))]))
+		}
+
+		checkApplyMatchesLinear(t, f, current, desired)
+	}
+}
+
+// checkApplyMatchesLinear writes the current entries to the hosts file f,
+// applies the desired hosts, and checks the changes and the entries written
+// against the linear reconciliation.
+func checkApplyMatchesLinear(t *testing.T, f *HostsFile, current []Entry, desired []Host) {
+	t.Helper()
+
+	content := "# managed by a test\n127.0.0.1 localhost\n" + hostsLines(current)
+	err := ioutil.WriteFile(f.Path, []byte(content), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantChanges, wantEntries := reconcileLinear(append([]Entry{entry("localhost", "127.0.0.1")}, current...), desired)
+
+	changes, err := f.Apply(context.Background(), desired)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Fatalf("Apply(%s, %s) = %+v, want %+v", formatEntries(current), formatHosts(desired), changes, wantChanges)
+	}
+
+	_, written, err := f.read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.ToLower(hostsLines(entriesOf(written)))
+	want := strings.ToLower(hostsLines(wantEntries))
+	if got != want {
+		t.Fatalf("Apply(%s, %s) wrote\n%s\nwant\n%s", formatEntries(current), formatHosts(desired), got, want)
+	}
+}
+
+// hostsLines renders entries as hosts file lines, one entry per line.
+func hostsLines(entries []Entry) string {
+	var b strings.Builder
+	for _, e := range entries {
+		if e.Disabled {
+			b.WriteString("# ")
+		}
+		fmt.Fprintf(&b, "%s %s\n", e.IP, e.Name)
+	}
+
+	return b.String()
+}
+
+func formatEntries(entries []Entry) string {
+	lines := make([]string, 0, len(entries))
+	for _, e := range entries {
+		prefix := ""
+		if e.Disabled {
+			prefix = "#"
+		}
+		lines = append(lines, fmt.Sprintf("%s%s %s", prefix, e.IP, e.Name))
+	}
+
+	return fmt.Sprintf("%q", lines)
+}
+
+func formatHosts(hosts []Host) string {
+	lines := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		lines = append(lines, fmt.Sprintf("%s %s", h.IP, h.Name))
+	}
+
+	return fmt.Sprintf("%q", lines)
+}
@@ -0,0 +1,120 @@
+package host
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func entry(name, ip string) Entry {
+	return Entry{Host: Host{Name: name, IP: net.ParseIP(ip)}}
+}
+
+func disabled(name, ip string) Entry {
+	e := entry(name, ip)
+	e.Disabled = true
+	return e
+}
+
+func hostOf(name, ip string) Host {
+	return Host{Name: name, IP: net.ParseIP(ip)}
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name    string
+		current []Entry
+		desired []Host
+		want    ChangeSet
+	}{
+		{
+			name:    "add",
+			current: []Entry{entry("router", "10.0.0.1")},
+			desired: []Host{hostOf("nas", "10.0.0.5")},
+			want: ChangeSet{Changes: []Change{
+				{Action: ActionAdd, Host: hostOf("nas", "10.0.0.5")},
+			}},
+		},
+		{
+			name:    "unchanged",
+			current: []Entry{entry("nas", "10.0.0.5")},
+			desired: []Host{hostOf("nas", "10.0.0.5")},
+			want:    ChangeSet{Unchanged: []Host{hostOf("nas", "10.0.0.5")}},
+		},
+		{
+			name:    "update",
+			current: []Entry{entry("nas", "10.0.0.5")},
+			desired: []Host{hostOf("nas", "10.0.0.7")},
+			want: ChangeSet{Changes: []Change{
+				{Action: ActionUpdate, Host: hostOf("nas", "10.0.0.7"), OldIP: net.ParseIP("10.0.0.5")},
+			}},
+		},
+		{
+			name:    "remove on IP takeover",
+			current: []Entry{entry("printer", "10.0.0.5"), entry("nas", "10.0.0.6")},
+			desired: []Host{hostOf("nas", "10.0.0.5")},
+			want: ChangeSet{Changes: []Change{
+				{Action: ActionRemove, Host: hostOf("printer", "10.0.0.5")},
+				{Action: ActionUpdate, Host: hostOf("nas", "10.0.0.5"), OldIP: net.ParseIP("10.0.0.6")},
+			}},
+		},
+		{
+			name:    "case mismatch on update",
+			current: []Entry{entry("NAS", "10.0.0.5")},
+			desired: []Host{hostOf("nas", "10.0.0.7")},
+			want: ChangeSet{Changes: []Change{
+				{Action: ActionUpdate, Host: hostOf("nas", "10.0.0.7"), OldIP: net.ParseIP("10.0.0.5")},
+			}},
+		},
+		{
+			name:    "duplicate names",
+			current: []Entry{entry("nas", "10.0.0.5"), entry("router", "10.0.0.1"), entry("NAS", "10.0.0.6"), disabled("nas", "10.0.0.8"), entry("nas", "fd00::5")},
+			desired: []Host{hostOf("nas", "10.0.0.7")},
+			want: ChangeSet{Changes: []Change{
+				{Action: ActionUpdate, Host: hostOf("nas", "10.0.0.7"), OldIP: net.ParseIP("10.0.0.5")},
+				{Action: ActionRemove, Host: hostOf("NAS", "10.0.0.6")},
+				{Action: ActionRemove, Host: hostOf("nas", "10.0.0.8")},
+			}},
+		},
+		{
+			name:    "case mismatch on same IP",
+			current: []Entry{entry("NAS", "10.0.0.5")},
+			desired: []Host{hostOf("nas", "10.0.0.5")},
+			want:    ChangeSet{Unchanged: []Host{hostOf("nas", "10.0.0.5")}},
+		},
+		{
+			name:    "re-enable",
+			current: []Entry{disabled("nas", "10.0.0.5")},
+			desired: []Host{hostOf("nas", "10.0.0.5")},
+			want: ChangeSet{Changes: []Change{
+				{Action: ActionAdd, Host: hostOf("nas", "10.0.0.5")},
+			}},
+		},
+		{
+			name:    "IP versions are kept apart",
+			current: []Entry{entry("nas", "fd00::5")},
+			desired: []Host{hostOf("nas", "10.0.0.5")},
+			want: ChangeSet{Changes: []Change{
+				{Action: ActionAdd, Host: hostOf("nas", "10.0.0.5")},
+			}},
+		},
+		{
+			name:    "other hosts are left alone",
+			current: []Entry{entry("router", "10.0.0.1"), entry("nas", "10.0.0.5")},
+			desired: []Host{hostOf("nas", "10.0.0.5")},
+			want:    ChangeSet{Unchanged: []Host{hostOf("nas", "10.0.0.5")}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := append([]Entry(nil), tt.current...)
+			got := Reconcile(current, tt.desired)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Reconcile() = %+v, want %+v", got, tt.want)
+			}
+			if !reflect.DeepEqual(current, tt.current) {
+				t.Errorf("Reconcile() modified current to %+v", current)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package host
+
+import (
+	"context"
+	"time"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/provider"
+)
+
+// Retry configures how the Updater retries fetching hosts from a provider.
+// The zero value makes a single attempt without a timeout.
+type Retry struct {
+	// Attempts is the total number of attempts made. Values below one are
+	// treated as one.
+	Attempts int
+	// Backoff is the delay before the second attempt. It doubles for each
+	// attempt after that.
+	Backoff time.Duration
+	// Timeout bounds each attempt. Zero means no timeout.
+	Timeout time.Duration
+	// Retryable reports whether an attempt that failed with err should be
+	// retried. When nil, only errors for which provider.IsTransient reports
+	// true are retried.
+	Retryable func(err error) bool
+}
+
+// Do calls fn until it succeeds, returns an error that is not retryable, or
+// the attempts run out, returning the last error. Each call gets a context
+// bounded by Timeout.
+func (r Retry) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	backoff := r.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err := r.attempt(ctx, fn)
+		if err == nil || attempt >= r.Attempts || !r.retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (r Retry) retryable(err error) bool {
+	if r.Retryable != nil {
+		return r.Retryable(err)
+	}
+
+	return provider.IsTransient(err)
+}
+
+func (r Retry) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+
+	return fn(ctx)
+}
+
+// WithRetry wraps p so that GetHosts is retried as configured by r. The error
+// of the last attempt is returned if every attempt fails or the error is not
+// retryable.
+func WithRetry(p provider.HostsProvider, r Retry) provider.HostsProvider {
+	return &retryingProvider{HostsProvider: p, retry: r}
+}
+
+type retryingProvider struct {
+	provider.HostsProvider
+	retry Retry
+}
+
+func (p *retryingProvider) GetHosts(ctx context.Context) ([]provider.Host, error) {
+	var hosts []provider.Host
+	err := p.retry.Do(ctx, func(ctx context.Context) error {
+		var err error
+		hosts, err = p.HostsProvider.GetHosts(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return hosts, nil
+}
@@ -0,0 +1,353 @@
+package host
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/provider"
+)
+
+// Transformer is a stage of the Updater's pipeline. It receives the hosts
+// produced by the previous stage and returns the hosts to pass to the next.
+type Transformer interface {
+	Transform(hosts []Host) []Host
+}
+
+// TransformerFunc adapts an ordinary function to a Transformer.
+type TransformerFunc func(hosts []Host) []Host
+
+// Transform implements Transformer.
+func (f TransformerFunc) Transform(hosts []Host) []Host {
+	return f(hosts)
+}
+
+// Updater runs hosts through an ordered pipeline of transformers and applies
+// the result to a sink. The On hooks are optional and called synchronously.
+type Updater struct {
+	Transformers []Transformer
+	Sink         Sink
+	// Retry configures how Fetch retries providers that fail.
+	Retry Retry
+	// Cache, when set, stores the hosts fetched from each provider so Fetch
+	// can serve them while the provider is unreachable, as long as they were
+	// fetched no more than MaxStaleness ago. A MaxStaleness of zero means
+	// cached hosts never become too stale.
+	Cache        Cache
+	MaxStaleness time.Duration
+
+	// OnBeforeApply is called with the transformed hosts before they are
+	// applied. Returning an error aborts the update.
+	OnBeforeApply func(ctx context.Context, hosts []Host) error
+	// OnAfterApply is called with the changes the sink made, even if there
+	// were none.
+	OnAfterApply func(ctx context.Context, changes ChangeSet)
+	// OnHostAdded is called for every host the sink added. Updates are
+	// reported as the removal of the old host followed by an addition.
+	OnHostAdded func(h Host)
+	// OnHostRemoved is called for every host the sink removed.
+	OnHostRemoved func(h Host)
+	// OnProviderFetched is called after Fetch tried to get the hosts of a
+	// provider, with the time taken including retries and the error of the
+	// last attempt, if any.
+	OnProviderFetched func(provider string, duration time.Duration, err error)
+	// OnCacheFallback is called when Fetch serves a provider's hosts from
+	// the cache because fetching them failed with err.
+	OnCacheFallback func(provider string, err error, fetchedAt time.Time)
+	// Duplicates picks which host the default pipeline's dedupe stage keeps
+	// when several share a name. The zero value is KeepLast.
+	Duplicates DuplicatePolicy
+
+	// OnInvalidHost is called for every host the default pipeline's
+	// Validate stage drops, with the reason it was dropped.
+	OnInvalidHost func(h Host, reason string)
+}
+
+// NewUpdater returns an Updater applying hosts to sink with the default
+// pipeline of Sanitize, Validate, and a dedupe stage following the
+// Duplicates policy. Further stages, such as overrides or filters, belong
+// between Validate and the dedupe stage.
+func NewUpdater(sink Sink) *Updater {
+	u := &Updater{Sink: sink}
+	u.Transformers = []Transformer{
+		Sanitize,
+		Validate(u.invalidHost),
+		TransformerFunc(func(hosts []Host) []Host {
+			return DedupeWith(u.Duplicates).Transform(hosts)
+		}),
+	}
+
+	return u
+}
+
+// Fetch gets the hosts of every provider, keyed by provider name, retrying
+// failed providers as configured by Retry and falling back to the Cache if
+// they still fail. Providers that fail regardless are left out of the result
+// and reported in a *FetchError, so that one failing provider does not stop
+// the others from being updated. Sinks only remove hosts whose IP was taken
+// by another, so the failed providers' hosts stay as they were.
+func (u *Updater) Fetch(ctx context.Context, providers map[string]provider.HostsProvider) (map[string][]Host, error) {
+	fetched := map[string][]Host{}
+	fetchErr := &FetchError{}
+	for name, p := range providers {
+		start := time.Now()
+		hosts, err := WithRetry(p, u.Retry).GetHosts(ctx)
+		if u.OnProviderFetched != nil {
+			u.OnProviderFetched(name, time.Since(start), err)
+		}
+		if err != nil {
+			hosts, err = u.fromCache(name, err)
+		} else if u.Cache != nil {
+			// The cache is best effort, failing to update it only means
+			// there is less to fall back to.
+			u.Cache.Put(name, CacheEntry{FetchedAt: time.Now(), Hosts: hosts})
+		}
+
+		if err != nil {
+			fetchErr.Errors = append(fetchErr.Errors, &provider.Error{Provider: name, Err: err})
+			continue
+		}
+
+		fetched[name] = hostsFromProvider(name, hosts)
+	}
+
+	if len(fetchErr.Errors) > 0 {
+		sort.Slice(fetchErr.Errors, func(i, j int) bool {
+			return fetchErr.Errors[i].Provider < fetchErr.Errors[j].Provider
+		})
+		return fetched, fetchErr
+	}
+
+	return fetched, nil
+}
+
+// FetchError reports the providers Fetch could not get hosts from, sorted by
+// provider name.
+type FetchError struct {
+	Errors []*provider.Error
+}
+
+func (e *FetchError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the error of the first provider that failed.
+func (e *FetchError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+
+	return e.Errors[0]
+}
+
+// fromCache returns the cached hosts of a provider that failed with fetchErr,
+// or fetchErr if there are none fresh enough.
+func (u *Updater) fromCache(name string, fetchErr error) ([]provider.Host, error) {
+	if u.Cache == nil {
+		return nil, fetchErr
+	}
+
+	entry, ok, err := u.Cache.Get(name)
+	if err != nil || !ok {
+		return nil, fetchErr
+	}
+
+	if u.MaxStaleness > 0 && time.Since(entry.FetchedAt) > u.MaxStaleness {
+		return nil, fetchErr
+	}
+
+	if u.OnCacheFallback != nil {
+		u.OnCacheFallback(name, fetchErr, entry.FetchedAt)
+	}
+
+	return entry.Hosts, nil
+}
+
+// Update runs hosts through the transformers in order and applies the result
+// to the sink, returning the changes the sink made. Hooks are only called
+// after a successful apply, or when a MultiSink applied the hosts to its
+// primary sink but not to all of the others, in which case the changes are
+// returned along with the *SinkError.
+func (u *Updater) Update(ctx context.Context, hosts []Host) (ChangeSet, error) {
+	for _, t := range u.Transformers {
+		hosts = t.Transform(hosts)
+	}
+
+	if u.OnBeforeApply != nil {
+		err := u.OnBeforeApply(ctx, hosts)
+		if err != nil {
+			return ChangeSet{}, err
+		}
+	}
+
+	changes, err := u.Sink.Apply(ctx, hosts)
+	var sinkErr *SinkError
+	if err != nil && !(errors.As(err, &sinkErr) && sinkErr.PrimaryApplied) {
+		return ChangeSet{}, err
+	}
+
+	for _, change := range changes.Changes {
+		switch change.Action {
+		case ActionAdd:
+			u.hostAdded(change.Host)
+		case ActionRemove:
+			u.hostRemoved(change.Host)
+		case ActionUpdate:
+			u.hostRemoved(Host{Name: change.Host.Name, IP: change.OldIP})
+			u.hostAdded(change.Host)
+		}
+	}
+
+	if u.OnAfterApply != nil {
+		u.OnAfterApply(ctx, changes)
+	}
+
+	return changes, err
+}
+
+func (u *Updater) hostAdded(h Host) {
+	if u.OnHostAdded != nil {
+		u.OnHostAdded(h)
+	}
+}
+
+func (u *Updater) hostRemoved(h Host) {
+	if u.OnHostRemoved != nil {
+		u.OnHostRemoved(h)
+	}
+}
+
+func (u *Updater) invalidHost(h Host, reason string) {
+	if u.OnInvalidHost != nil {
+		u.OnInvalidHost(h, reason)
+	}
+}
+
+// hostsFromProvider converts the hosts reported by the named provider into
+// hosts sorted by name. Hosts with the same name keep the provider's order.
+func hostsFromProvider(name string, hosts []provider.Host) []Host {
+	toReturn := make([]Host, 0, len(hosts))
+	for _, h := range hosts {
+		toReturn = append(toReturn, Host{Name: h.Name, IP: h.IP, MAC: h.MAC, Static: h.Static, Provider: name})
+	}
+
+	sort.SliceStable(toReturn, func(i, j int) bool {
+		return toReturn[i].Name < toReturn[j].Name
+	})
+
+	return toReturn
+}
+
+// Sanitize trims the hostnames and replaces any whitespace within them with a
+// dash so that each host is a single hosts file entry.
+var Sanitize Transformer = TransformerFunc(func(hosts []Host) []Host {
+	toReturn := make([]Host, 0, len(hosts))
+	for _, h := range hosts {
+		h.Name = strings.Join(strings.FieldsFunc(h.Name, unicode.IsSpace), "-")
+		toReturn = append(toReturn, h)
+	}
+
+	return toReturn
+})
+
+// Validate returns a Transformer that drops hosts without a name, without an
+// IP, or with a malformed MAC, calling invalid with each dropped host and the
+// reason, so that one bad entry from a provider does not fail the whole
+// update. MACs of the remaining hosts are normalized. invalid may be nil.
+func Validate(invalid func(h Host, reason string)) Transformer {
+	return TransformerFunc(func(hosts []Host) []Host {
+		toReturn := make([]Host, 0, len(hosts))
+		for _, h := range hosts {
+			reason := ""
+			switch {
+			case h.Name == "":
+				reason = "empty hostname"
+			case h.IP == nil:
+				reason = "missing or unparseable IP"
+			case h.MAC != "":
+				mac, err := net.ParseMAC(h.MAC)
+				if err != nil {
+					reason = "malformed MAC"
+					break
+				}
+				h.MAC = mac.String()
+			}
+
+			if reason != "" {
+				if invalid != nil {
+					invalid(h, reason)
+				}
+				continue
+			}
+
+			toReturn = append(toReturn, h)
+		}
+
+		return toReturn
+	})
+}
+
+// DuplicatePolicy decides which of several hosts with the same name, such as
+// a device with both a wired and a wireless lease, is written. Both policies
+// only depend on the order hosts are reported in, which providers keep stable
+// between runs, so the chosen IP does not flap.
+type DuplicatePolicy string
+
+// The supported duplicate policies.
+const (
+	// KeepLast keeps the host reported last, so later providers override
+	// earlier ones.
+	KeepLast DuplicatePolicy = "last"
+	// PreferStatic keeps the last static host, such as a DHCP static
+	// mapping, and otherwise the last host.
+	PreferStatic DuplicatePolicy = "static"
+)
+
+// ParseDuplicatePolicy returns the DuplicatePolicy named s.
+func ParseDuplicatePolicy(s string) (DuplicatePolicy, error) {
+	switch p := DuplicatePolicy(s); p {
+	case KeepLast, PreferStatic:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown duplicate policy %q, expected %q or %q", s, KeepLast, PreferStatic)
+	}
+}
+
+// Dedupe removes hosts whose name, compared case insensitively, appears again
+// later in the list, so the last host for a name wins.
+var Dedupe = DedupeWith(KeepLast)
+
+// DedupeWith returns a Transformer keeping one host per name, compared case
+// insensitively, as chosen by policy. Kept hosts stay in their original
+// order. The zero policy is KeepLast.
+func DedupeWith(policy DuplicatePolicy) Transformer {
+	return TransformerFunc(func(hosts []Host) []Host {
+		keep := map[string]int{}
+		for i, h := range hosts {
+			name := strings.ToLower(h.Name)
+			if kept, ok := keep[name]; ok && policy == PreferStatic && hosts[kept].Static && !h.Static {
+				continue
+			}
+			keep[name] = i
+		}
+
+		toReturn := make([]Host, 0, len(keep))
+		for i, h := range hosts {
+			if keep[strings.ToLower(h.Name)] == i {
+				toReturn = append(toReturn, h)
+			}
+		}
+
+		return toReturn
+	})
+}
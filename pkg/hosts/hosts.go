@@ -0,0 +1,385 @@
+// Package hosts reads and edits hosts files such as /etc/hosts. Lines are
+// kept exactly as they were unless an edit touches them, and entries are
+// indexed by IP and by hostname so that files with tens of thousands of
+// entries can be edited without scanning them for every change.
+package hosts
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+)
+
+// PathEnv names the environment variable that overrides the location of the
+// system hosts file. It keeps the name used by hostess, which earlier
+// versions relied on.
+const PathEnv = "HOSTESS_PATH"
+
+// DefaultPath returns the location of the system hosts file, which is $PathEnv
+// if set.
+func DefaultPath() string {
+	if path := os.Getenv(PathEnv); path != "" {
+		return path
+	}
+
+	if runtime.GOOS == "windows" {
+		return `C:\Windows\System32\drivers\etc\hosts`
+	}
+
+	return "/etc/hosts"
+}
+
+// Entry maps a hostname to an IP. Entries on commented out lines, such as
+// "# 192.168.1.5 nas", are disabled. The fields must not be modified, the
+// File's methods keep them and its indexes up to date.
+type Entry struct {
+	Name    string
+	IP      net.IP
+	Enabled bool
+
+	line *line
+}
+
+// line is a line of a hosts file. Lines that hold no entries, such as blank
+// lines and comments, are kept verbatim.
+type line struct {
+	raw string
+	eol string
+
+	// The parts of a line holding entries, set when entries is.
+	prefix  string // leading whitespace, and "#" for disabled lines
+	ip      string
+	sep     string // whitespace between the IP and the first hostname
+	comment string // trailing whitespace and comment
+	entries []*Entry
+
+	// dirty is set once the entries changed so the line must be rendered
+	// from its parts instead of raw.
+	dirty bool
+	// inserted holds lines added by edits, written right after this one.
+	inserted []*line
+}
+
+// File is a parsed hosts file.
+type File struct {
+	// head holds the lines read. Added entries go on lines in tail.
+	head []*line
+	tail []*line
+	eol  string
+
+	byIP   map[string][]*Entry
+	byName map[string][]*Entry
+	count  int
+}
+
+// Parse reads a hosts file from r a line at a time. Lines that do not start
+// with an IP, optionally commented out, are kept but hold no entries.
+func Parse(r io.Reader) (*File, error) {
+	f := &File{
+		byIP:   map[string][]*Entry{},
+		byName: map[string][]*Entry{},
+	}
+
+	br := bufio.NewReader(r)
+	for {
+		text, err := br.ReadString('\n')
+		if text != "" {
+			l := parseLine(text)
+			if f.eol == "" {
+				f.eol = l.eol
+			}
+			f.head = append(f.head, l)
+			for _, e := range l.entries {
+				f.index(e)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if f.eol == "" {
+		f.eol = "\n"
+	}
+
+	return f, nil
+}
+
+func parseLine(text string) *line {
+	l := &line{raw: text}
+	switch {
+	case strings.HasSuffix(text, "\r\n"):
+		l.raw, l.eol = text[:len(text)-2], "\r\n"
+	case strings.HasSuffix(text, "\n"):
+		l.raw, l.eol = text[:len(text)-1], "\n"
+	}
+
+	rest := strings.TrimLeft(l.raw, " \t")
+	enabled := true
+	if strings.HasPrefix(rest, "#") {
+		enabled = false
+		rest = strings.TrimLeft(rest[1:], " \t")
+	}
+	prefix := l.raw[:len(l.raw)-len(rest)]
+
+	body, comment := rest, ""
+	if i := strings.IndexByte(rest, '#'); i >= 0 {
+		body, comment = rest[:i], rest[i:]
+	}
+	trimmed := strings.TrimRight(body, " \t")
+	comment = body[len(trimmed):] + comment
+	body = trimmed
+
+	fields := strings.Fields(body)
+	if len(fields) < 2 {
+		return l
+	}
+	ip := net.ParseIP(fields[0])
+	if ip == nil {
+		return l
+	}
+
+	afterIP := body[len(fields[0]):]
+	l.prefix = prefix
+	l.ip = fields[0]
+	l.sep = afterIP[:len(afterIP)-len(strings.TrimLeft(afterIP, " \t"))]
+	l.comment = comment
+	for _, name := range fields[1:] {
+		l.entries = append(l.entries, &Entry{Name: name, IP: ip, Enabled: enabled, line: l})
+	}
+
+	return l
+}
+
+// Len returns the number of entries in the file.
+func (f *File) Len() int {
+	return f.count
+}
+
+// Entries returns the entries in the order they appear in the file.
+func (f *File) Entries() []*Entry {
+	entries := make([]*Entry, 0, f.count)
+	f.walk(func(l *line) {
+		entries = append(entries, l.entries...)
+	})
+
+	return entries
+}
+
+// LookupIP returns the entries for ip, in the order they were added to the
+// index.
+func (f *File) LookupIP(ip net.IP) []*Entry {
+	return f.byIP[ip.String()]
+}
+
+// LookupName returns the entries for the hostname name, compared exactly, in
+// the order they were added to the index.
+func (f *File) LookupName(name string) []*Entry {
+	return f.byName[name]
+}
+
+// Add adds an enabled entry for name and ip on a new line at the end of the
+// file.
+func (f *File) Add(name string, ip net.IP) *Entry {
+	l := f.newLine(ip, true)
+	f.tail = append(f.tail, l)
+
+	return f.attach(l, name, ip, true)
+}
+
+// Remove removes e from the file, along with its line if it holds no other
+// entries.
+func (f *File) Remove(e *Entry) {
+	f.detach(e)
+}
+
+// SetIP points e at ip. If other entries share the line of e, e is moved to a
+// new line right after it.
+func (f *File) SetIP(e *Entry, ip net.IP) *Entry {
+	if len(e.line.entries) == 1 {
+		f.unindex(e)
+		e.IP = ip
+		e.line.ip = ip.String()
+		e.line.dirty = true
+		f.index(e)
+		return e
+	}
+
+	return f.move(e, ip, e.Enabled)
+}
+
+// Enable uncomments the line of e. If other entries share the line, e is
+// moved to a new line right after it instead.
+func (f *File) Enable(e *Entry) *Entry {
+	if e.Enabled {
+		return e
+	}
+
+	if len(e.line.entries) == 1 {
+		e.Enabled = true
+		e.line.prefix = strings.TrimRight(e.line.prefix, "# \t")
+		e.line.dirty = true
+		return e
+	}
+
+	return f.move(e, e.IP, true)
+}
+
+// move replaces e with a new entry on a new line inserted after its own.
+func (f *File) move(e *Entry, ip net.IP, enabled bool) *Entry {
+	origin := e.line
+	f.detach(e)
+
+	l := f.newLine(ip, enabled)
+	l.prefix = strings.TrimRight(origin.prefix, "# \t")
+	if !enabled {
+		l.prefix += "# "
+	}
+	origin.inserted = append(origin.inserted, l)
+
+	return f.attach(l, e.Name, ip, enabled)
+}
+
+func (f *File) newLine(ip net.IP, enabled bool) *line {
+	l := &line{ip: ip.String(), sep: " ", eol: f.eol, dirty: true}
+	if !enabled {
+		l.prefix = "# "
+	}
+
+	return l
+}
+
+func (f *File) attach(l *line, name string, ip net.IP, enabled bool) *Entry {
+	e := &Entry{Name: name, IP: ip, Enabled: enabled, line: l}
+	l.entries = append(l.entries, e)
+	f.index(e)
+
+	return e
+}
+
+func (f *File) detach(e *Entry) {
+	l := e.line
+	for i, other := range l.entries {
+		if other == e {
+			l.entries = append(l.entries[:i:i], l.entries[i+1:]...)
+			break
+		}
+	}
+	l.dirty = true
+	f.unindex(e)
+}
+
+func (f *File) index(e *Entry) {
+	ip := e.IP.String()
+	f.byIP[ip] = append(f.byIP[ip], e)
+	f.byName[e.Name] = append(f.byName[e.Name], e)
+	f.count++
+}
+
+func (f *File) unindex(e *Entry) {
+	ip := e.IP.String()
+	f.byIP[ip] = without(f.byIP[ip], e)
+	if len(f.byIP[ip]) == 0 {
+		delete(f.byIP, ip)
+	}
+	f.byName[e.Name] = without(f.byName[e.Name], e)
+	if len(f.byName[e.Name]) == 0 {
+		delete(f.byName, e.Name)
+	}
+	f.count--
+}
+
+func without(entries []*Entry, e *Entry) []*Entry {
+	for i, other := range entries {
+		if other == e {
+			return append(entries[:i:i], entries[i+1:]...)
+		}
+	}
+
+	return entries
+}
+
+// walk calls fn for every line in file order, including inserted ones.
+func (f *File) walk(fn func(l *line)) {
+	var visit func(l *line)
+	visit = func(l *line) {
+		fn(l)
+		for _, inserted := range l.inserted {
+			visit(inserted)
+		}
+	}
+
+	for _, l := range f.head {
+		visit(l)
+	}
+	for _, l := range f.tail {
+		visit(l)
+	}
+}
+
+// WriteTo writes the file to w. Lines no edit touched are written as they
+// were read, and lines left without entries by edits are dropped.
+func (f *File) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var n int64
+	var err error
+	// unterminated is set after writing a last line that had no line break,
+	// which lines added after it need.
+	unterminated := false
+	f.walk(func(l *line) {
+		if err != nil || (l.dirty && len(l.entries) == 0) {
+			return
+		}
+
+		text := l.raw + l.eol
+		if l.dirty {
+			text = l.render()
+		}
+		if unterminated {
+			text = f.eol + text
+		}
+		unterminated = l.eol == ""
+
+		written, werr := bw.WriteString(text)
+		n += int64(written)
+		err = werr
+	})
+	if err != nil {
+		return n, err
+	}
+
+	return n, bw.Flush()
+}
+
+// Bytes returns the contents of the file.
+func (f *File) Bytes() []byte {
+	var buf bytes.Buffer
+	f.WriteTo(&buf)
+
+	return buf.Bytes()
+}
+
+// render formats a line from its parts.
+func (l *line) render() string {
+	var sb strings.Builder
+	sb.WriteString(l.prefix)
+	sb.WriteString(l.ip)
+	sb.WriteString(l.sep)
+	for i, e := range l.entries {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(e.Name)
+	}
+	sb.WriteString(l.comment)
+	sb.WriteString(l.eol)
+
+	return sb.String()
+}
@@ -0,0 +1,344 @@
+package hosts
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func parse(t testing.TB, content string) *File {
+	t.Helper()
+
+	f, err := Parse(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	return f
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"empty", ""},
+		{"blank lines", "\n\n\n"},
+		{"typical", "127.0.0.1\tlocalhost\n::1 localhost ip6-localhost\n\n# managed below\n10.0.0.5 nas\n"},
+		{"no final line break", "127.0.0.1 localhost\n10.0.0.5 nas"},
+		{"CRLF", "127.0.0.1 localhost\r\n10.0.0.5 nas\r\n"},
+		{"comments and whitespace", "  10.0.0.5   nas  nas.lan\t# the NAS  \n\t# 10.0.0.6 printer\n#10.0.0.7 tv\n"},
+		{"junk", "not an entry\n10.0.0.5\n999.0.0.1 bad\n# just a comment\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := parse(t, tt.content)
+
+			var buf bytes.Buffer
+			n, err := f.WriteTo(&buf)
+			if err != nil {
+				t.Fatalf("WriteTo() error = %v", err)
+			}
+			if got := buf.String(); got != tt.content {
+				t.Errorf("WriteTo() wrote %q, want %q", got, tt.content)
+			}
+			if n != int64(len(tt.content)) {
+				t.Errorf("WriteTo() = %d, want %d", n, len(tt.content))
+			}
+		})
+	}
+}
+
+// entryString describes e as a hosts file line, for comparing entries.
+func entryString(e *Entry) string {
+	if !e.Enabled {
+		return "# " + e.IP.String() + " " + e.Name
+	}
+
+	return e.IP.String() + " " + e.Name
+}
+
+func entryStrings(entries []*Entry) []string {
+	s := make([]string, 0, len(entries))
+	for _, e := range entries {
+		s = append(s, entryString(e))
+	}
+
+	return s
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"empty", "", []string{}},
+		{"one entry", "10.0.0.5 nas\n", []string{"10.0.0.5 nas"}},
+		{"aliases", "10.0.0.5 nas nas.lan\n", []string{"10.0.0.5 nas", "10.0.0.5 nas.lan"}},
+		{"IPv6", "fd00::5 nas\n", []string{"fd00::5 nas"}},
+		{"disabled", "# 10.0.0.5 nas\n#10.0.0.6 tv\n", []string{"# 10.0.0.5 nas", "# 10.0.0.6 tv"}},
+		{"trailing comment", "10.0.0.5 nas # the NAS\n", []string{"10.0.0.5 nas"}},
+		{"comment glued to name", "10.0.0.5 nas#old\n", []string{"10.0.0.5 nas"}},
+		{"comments are not entries", "# hosts file\n# see man hosts\n", []string{}},
+		{"IP without name", "10.0.0.5\n", []string{}},
+		{"invalid IP", "10.0.0.256 nas\n", []string{}},
+		{"no final line break", "10.0.0.5 nas", []string{"10.0.0.5 nas"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := parse(t, tt.content)
+
+			got := entryStrings(f.Entries())
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Entries() = %q, want %q", got, tt.want)
+			}
+			if f.Len() != len(tt.want) {
+				t.Errorf("Len() = %d, want %d", f.Len(), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	f := parse(t, "10.0.0.5 nas nas.lan\n10.0.0.6 printer\n# 10.0.0.5 old-nas\n")
+
+	if got, want := entryStrings(f.LookupIP(net.ParseIP("10.0.0.5"))), []string{"10.0.0.5 nas", "10.0.0.5 nas.lan", "# 10.0.0.5 old-nas"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LookupIP(10.0.0.5) = %q, want %q", got, want)
+	}
+	if got, want := entryStrings(f.LookupName("printer")), []string{"10.0.0.6 printer"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LookupName(printer) = %q, want %q", got, want)
+	}
+	if got := f.LookupName("NAS"); len(got) != 0 {
+		t.Errorf("LookupName(NAS) = %q, want nothing as names are compared exactly", entryStrings(got))
+	}
+
+	f.SetIP(f.LookupName("printer")[0], net.ParseIP("10.0.0.7"))
+	if got := f.LookupIP(net.ParseIP("10.0.0.6")); len(got) != 0 {
+		t.Errorf("LookupIP(10.0.0.6) after SetIP = %q, want nothing", entryStrings(got))
+	}
+	if got, want := entryStrings(f.LookupIP(net.ParseIP("10.0.0.7"))), []string{"10.0.0.7 printer"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("LookupIP(10.0.0.7) after SetIP = %q, want %q", got, want)
+	}
+
+	f.Remove(f.LookupName("nas.lan")[0])
+	if got := f.LookupName("nas.lan"); len(got) != 0 {
+		t.Errorf("LookupName(nas.lan) after Remove = %q, want nothing", entryStrings(got))
+	}
+	if f.Len() != 3 {
+		t.Errorf("Len() = %d, want 3", f.Len())
+	}
+}
+
+func TestEdit(t *testing.T) {
+	ip := net.ParseIP
+	first := func(f *File, name string) *Entry {
+		return f.LookupName(name)[0]
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		edit    func(f *File)
+		want    string
+	}{
+		{
+			name:    "set IP keeps whitespace and comment",
+			content: "127.0.0.1 localhost\n  10.0.0.5\tnas   # the NAS\n",
+			edit:    func(f *File) { f.SetIP(first(f, "nas"), ip("10.0.0.9")) },
+			want:    "127.0.0.1 localhost\n  10.0.0.9\tnas   # the NAS\n",
+		},
+		{
+			name:    "set IP of an alias moves it to a new line",
+			content: "10.0.0.5 nas nas.lan # the NAS\n10.0.0.6 printer\n",
+			edit:    func(f *File) { f.SetIP(first(f, "nas.lan"), ip("10.0.0.9")) },
+			want:    "10.0.0.5 nas # the NAS\n10.0.0.9 nas.lan\n10.0.0.6 printer\n",
+		},
+		{
+			name:    "set IP keeps a disabled entry disabled",
+			content: "# 10.0.0.5 nas\n",
+			edit:    func(f *File) { f.SetIP(first(f, "nas"), ip("10.0.0.9")) },
+			want:    "# 10.0.0.9 nas\n",
+		},
+		{
+			name:    "set IP of a disabled alias",
+			content: "# 10.0.0.5 nas nas.lan\n",
+			edit:    func(f *File) { f.SetIP(first(f, "nas.lan"), ip("10.0.0.9")) },
+			want:    "# 10.0.0.5 nas\n# 10.0.0.9 nas.lan\n",
+		},
+		{
+			name:    "enable",
+			content: "# 10.0.0.5 nas # the NAS\n",
+			edit:    func(f *File) { f.Enable(first(f, "nas")) },
+			want:    "10.0.0.5 nas # the NAS\n",
+		},
+		{
+			name:    "enable an alias moves it to a new line",
+			content: "#10.0.0.5 nas nas.lan\n",
+			edit:    func(f *File) { f.Enable(first(f, "nas.lan")) },
+			want:    "#10.0.0.5 nas\n10.0.0.5 nas.lan\n",
+		},
+		{
+			name:    "enable an enabled entry",
+			content: "10.0.0.5 nas\n",
+			edit:    func(f *File) { f.Enable(first(f, "nas")) },
+			want:    "10.0.0.5 nas\n",
+		},
+		{
+			name:    "remove drops the line",
+			content: "127.0.0.1 localhost\n10.0.0.5 nas # the NAS\n\n# end\n",
+			edit:    func(f *File) { f.Remove(first(f, "nas")) },
+			want:    "127.0.0.1 localhost\n\n# end\n",
+		},
+		{
+			name:    "remove a disabled entry",
+			content: "# 10.0.0.5 nas\n10.0.0.6 printer\n",
+			edit:    func(f *File) { f.Remove(first(f, "nas")) },
+			want:    "10.0.0.6 printer\n",
+		},
+		{
+			name:    "remove an alias keeps the line",
+			content: "10.0.0.5  nas nas.lan # the NAS\n",
+			edit:    func(f *File) { f.Remove(first(f, "nas")) },
+			want:    "10.0.0.5  nas.lan # the NAS\n",
+		},
+		{
+			name:    "add appends",
+			content: "127.0.0.1 localhost\n",
+			edit:    func(f *File) { f.Add("nas", ip("10.0.0.5")) },
+			want:    "127.0.0.1 localhost\n10.0.0.5 nas\n",
+		},
+		{
+			name:    "add after a last line without line break",
+			content: "127.0.0.1 localhost",
+			edit:    func(f *File) { f.Add("nas", ip("10.0.0.5")) },
+			want:    "127.0.0.1 localhost\n10.0.0.5 nas\n",
+		},
+		{
+			name:    "add keeps CRLF",
+			content: "127.0.0.1 localhost\r\n",
+			edit:    func(f *File) { f.Add("nas", ip("10.0.0.5")) },
+			want:    "127.0.0.1 localhost\r\n10.0.0.5 nas\r\n",
+		},
+		{
+			name:    "add to an empty file",
+			content: "",
+			edit:    func(f *File) { f.Add("nas", ip("fd00::5")) },
+			want:    "fd00::5 nas\n",
+		},
+		{
+			name:    "add then remove",
+			content: "127.0.0.1 localhost\n",
+			edit:    func(f *File) { f.Remove(f.Add("nas", ip("10.0.0.5"))) },
+			want:    "127.0.0.1 localhost\n",
+		},
+		{
+			name:    "set IP then enable a moved alias",
+			content: "# 10.0.0.5 nas nas.lan\n",
+			edit: func(f *File) {
+				e := f.SetIP(first(f, "nas.lan"), ip("10.0.0.9"))
+				f.Enable(e)
+			},
+			want: "# 10.0.0.5 nas\n10.0.0.9 nas.lan\n",
+		},
+		{
+			name:    "untouched lines are kept verbatim",
+			content: "# header\n\t127.0.0.1   localhost\t# loopback\n10.0.0.5 nas\n  \n10.0.0.6 printer\n",
+			edit:    func(f *File) { f.SetIP(first(f, "nas"), ip("10.0.0.9")) },
+			want:    "# header\n\t127.0.0.1   localhost\t# loopback\n10.0.0.9 nas\n  \n10.0.0.6 printer\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := parse(t, tt.content)
+			tt.edit(f)
+
+			got := string(f.Bytes())
+			if got != tt.want {
+				t.Errorf("after edit the file is %q, want %q", got, tt.want)
+			}
+
+			// The edited file must parse back to the same entries.
+			reparsed := parse(t, got)
+			if !reflect.DeepEqual(entryStrings(reparsed.Entries()), entryStrings(f.Entries())) {
+				t.Errorf("reparsed entries %q, want %q", entryStrings(reparsed.Entries()), entryStrings(f.Entries()))
+			}
+		})
+	}
+}
+
+// benchmarkFile returns a hosts file of n lines mixing comments, disabled
+// entries, and aliases.
+func benchmarkFile(n int) []byte {
+	var b bytes.Buffer
+	b.WriteString("# generated for benchmarks\n127.0.0.1 localhost\n::1 localhost ip6-localhost\n")
+	for i := 0; i < n; i++ {
+		ip := fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)
+		switch i % 10 {
+		case 0:
+			fmt.Fprintf(&b, "# host-%d\n", i)
+		case 1:
+			fmt.Fprintf(&b, "# %s host-%d\n", ip, i)
+		case 2:
+			fmt.Fprintf(&b, "%s\thost-%d host-%d.lan # alias\n", ip, i, i)
+		default:
+			fmt.Fprintf(&b, "%s host-%d\n", ip, i)
+		}
+	}
+
+	return b.Bytes()
+}
+
+const benchmarkLines = 50000
+
+func BenchmarkParse(b *testing.B) {
+	content := benchmarkFile(benchmarkLines)
+	b.SetBytes(int64(len(content)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		_, err := Parse(bytes.NewReader(content))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkApply measures editing a large file the way a sync does: looking
+// up, updating, enabling, removing and adding a few hundred entries, then
+// writing the file.
+func BenchmarkApply(b *testing.B) {
+	content := benchmarkFile(benchmarkLines)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		f, err := Parse(bytes.NewReader(content))
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+
+		for j := 0; j < benchmarkLines; j += 100 {
+			for _, e := range f.LookupName(fmt.Sprintf("host-%d", j+1)) {
+				f.Enable(e)
+			}
+			for _, e := range f.LookupName(fmt.Sprintf("host-%d.lan", j+2)) {
+				f.SetIP(e, net.ParseIP("192.168.0.1"))
+			}
+			for _, e := range f.LookupName(fmt.Sprintf("host-%d", j+3)) {
+				f.Remove(e)
+			}
+			f.Add(fmt.Sprintf("new-%d", j), net.ParseIP("192.168.1.1"))
+		}
+
+		_, err = f.WriteTo(ioutil.Discard)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Package hosttest provides fakes and helpers for testing providers, sinks,
+// and code built on the Updater without a router or a real hosts file.
+package hosttest
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/host"
+	"github.com/grounded042/dhcp-hosts-updater/pkg/provider"
+)
+
+// UpdateGoldenEnv names the environment variable that, when set to 1, makes
+// Golden rewrite golden files with the output under test instead of comparing
+// against them.
+const UpdateGoldenEnv = "HOSTTEST_UPDATE"
+
+// Provider is a fake provider.HostsProvider returning fixed hosts.
+type Provider struct {
+	// Hosts is returned by GetHosts unless Err is set.
+	Hosts []provider.Host
+	// Err is returned by GetHosts when set.
+	Err error
+	// CheckErr is returned by Check.
+	CheckErr error
+
+	mu    sync.Mutex
+	calls int
+}
+
+// GetHosts implements provider.HostsProvider.
+func (p *Provider) GetHosts(ctx context.Context) ([]provider.Host, error) {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+
+	if p.Err != nil {
+		return nil, p.Err
+	}
+
+	return append([]provider.Host(nil), p.Hosts...), nil
+}
+
+// Check implements provider.HostsProvider.
+func (p *Provider) Check(ctx context.Context) error {
+	return p.CheckErr
+}
+
+// Calls returns the number of times GetHosts has been called.
+func (p *Provider) Calls() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.calls
+}
+
+// Definition returns a provider.Definition named name that always creates p,
+// for registering the fake with provider.Register.
+func Definition(name string, p *Provider) provider.Definition {
+	return provider.Definition{
+		Name: name,
+		New: func(flags map[string]string, opts provider.Options) (provider.HostsProvider, error) {
+			return p, nil
+		},
+	}
+}
+
+// Sink is a fake host.Sink holding hosts in memory. Unlike a hosts file it
+// replaces its contents with the desired hosts on every Apply, reporting
+// changes by hostname.
+type Sink struct {
+	// Hosts is the current contents of the sink.
+	Hosts []host.Host
+	// Err is returned by Apply when set, without changing Hosts.
+	Err error
+	// ChangeSets records the result of every successful Apply.
+	ChangeSets []host.ChangeSet
+
+	mu sync.Mutex
+}
+
+// Apply implements host.Sink.
+func (s *Sink) Apply(ctx context.Context, desired []host.Host) (host.ChangeSet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Err != nil {
+		return host.ChangeSet{}, s.Err
+	}
+
+	current := map[string]host.Host{}
+	for _, h := range s.Hosts {
+		current[h.Name] = h
+	}
+
+	var changes host.ChangeSet
+	for _, h := range desired {
+		existing, ok := current[h.Name]
+		switch {
+		case !ok:
+			changes.Changes = append(changes.Changes, host.Change{Action: host.ActionAdd, Host: h})
+		case !existing.IP.Equal(h.IP):
+			changes.Changes = append(changes.Changes, host.Change{Action: host.ActionUpdate, Host: h, OldIP: existing.IP})
+		default:
+			changes.Unchanged = append(changes.Unchanged, h)
+		}
+		delete(current, h.Name)
+	}
+
+	for _, h := range SortHosts(hostsOf(current)) {
+		changes.Changes = append(changes.Changes, host.Change{Action: host.ActionRemove, Host: h})
+	}
+
+	s.Hosts = append([]host.Host(nil), desired...)
+	s.ChangeSets = append(s.ChangeSets, changes)
+
+	return changes, nil
+}
+
+func hostsOf(m map[string]host.Host) []host.Host {
+	hosts := make([]host.Host, 0, len(m))
+	for _, h := range m {
+		hosts = append(hosts, h)
+	}
+
+	return hosts
+}
+
+// SortHosts sorts hosts by name, then IP, in place and returns them.
+func SortHosts(hosts []host.Host) []host.Host {
+	sort.Slice(hosts, func(i, j int) bool {
+		if hosts[i].Name != hosts[j].Name {
+			return hosts[i].Name < hosts[j].Name
+		}
+		return hosts[i].IP.String() < hosts[j].IP.String()
+	})
+
+	return hosts
+}
+
+// FormatHosts renders hosts as hosts file lines, sorted by name, for
+// comparing against golden files.
+func FormatHosts(hosts []host.Host) []byte {
+	sorted := SortHosts(append([]host.Host(nil), hosts...))
+
+	var b bytes.Buffer
+	for _, h := range sorted {
+		fmt.Fprintf(&b, "%s %s\n", h.IP, h.Name)
+	}
+
+	return b.Bytes()
+}
+
+// Golden compares got with the contents of the golden file at path, failing
+// t if they differ. With $HOSTTEST_UPDATE set to 1 the golden file is
+// written with got instead.
+func Golden(t testing.TB, path string, got []byte) {
+	t.Helper()
+
+	if os.Getenv(UpdateGoldenEnv) == "1" {
+		err := ioutil.WriteFile(path, got, 0644)
+		if err != nil {
+			t.Fatalf("could not update golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read golden file: %v", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("output does not match %s\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// GoldenHosts compares hosts, rendered with FormatHosts, with the golden file
+// at path.
+func GoldenHosts(t testing.TB, path string, hosts []host.Host) {
+	t.Helper()
+
+	Golden(t, path, FormatHosts(hosts))
+}
+
+// NewTLSServer starts a TLS server that answers each request with the body in
+// responses keyed by the request's path and query, e.g.
+// "/api/edge/get.json", and 404 for anything else. The server's listener
+// address is suitable for a provider's address flag. Callers should Close the
+// server when done.
+func NewTLSServer(t testing.TB, responses map[string]string) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := responses[r.URL.RequestURI()]
+		if !ok {
+			body, ok = responses[r.URL.Path]
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprint(w, body)
+	}))
+	server.TLS = &tls.Config{}
+	server.StartTLS()
+
+	return server
+}
@@ -0,0 +1,209 @@
+package hosttest_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/host"
+	"github.com/grounded042/dhcp-hosts-updater/pkg/hosttest"
+	"github.com/grounded042/dhcp-hosts-updater/pkg/provider"
+)
+
+func TestProvider(t *testing.T) {
+	p := &hosttest.Provider{Hosts: []provider.Host{{Name: "nas", IP: net.ParseIP("10.0.0.5")}}}
+
+	hosts, err := p.GetHosts(context.Background())
+	if err != nil {
+		t.Fatalf("GetHosts() error = %v", err)
+	}
+	hosts[0].Name = "changed"
+	if p.Hosts[0].Name != "nas" {
+		t.Errorf("GetHosts() returned the provider's own slice")
+	}
+
+	p.Err = errors.New("boom")
+	if _, err := p.GetHosts(context.Background()); err != p.Err {
+		t.Errorf("GetHosts() error = %v, want %v", err, p.Err)
+	}
+	if got := p.Calls(); got != 2 {
+		t.Errorf("Calls() = %d, want 2", got)
+	}
+
+	p.CheckErr = provider.ErrAuthFailed
+	if err := p.Check(context.Background()); err != provider.ErrAuthFailed {
+		t.Errorf("Check() error = %v, want %v", err, provider.ErrAuthFailed)
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	p := &hosttest.Provider{}
+	def := hosttest.Definition("fake", p)
+	if def.Name != "fake" {
+		t.Errorf("Name = %q, want fake", def.Name)
+	}
+
+	got, err := def.New(nil, provider.Options{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if got != p {
+		t.Errorf("New() = %v, want the fake provider", got)
+	}
+}
+
+func TestSinkApply(t *testing.T) {
+	nas := host.Host{Name: "nas", IP: net.ParseIP("10.0.0.5")}
+	printer := host.Host{Name: "printer", IP: net.ParseIP("10.0.0.6")}
+	tv := host.Host{Name: "tv", IP: net.ParseIP("10.0.0.7")}
+	movedNAS := host.Host{Name: "nas", IP: net.ParseIP("10.0.0.9")}
+
+	s := &hosttest.Sink{Hosts: []host.Host{nas, printer}}
+	changes, err := s.Apply(context.Background(), []host.Host{movedNAS, tv})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	want := host.ChangeSet{Changes: []host.Change{
+		{Action: host.ActionUpdate, Host: movedNAS, OldIP: nas.IP},
+		{Action: host.ActionAdd, Host: tv},
+		{Action: host.ActionRemove, Host: printer},
+	}}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("Apply() = %+v, want %+v", changes, want)
+	}
+	if !reflect.DeepEqual(s.Hosts, []host.Host{movedNAS, tv}) {
+		t.Errorf("Hosts = %v, want the desired hosts", s.Hosts)
+	}
+
+	changes, err = s.Apply(context.Background(), []host.Host{movedNAS, tv})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if len(changes.Changes) != 0 || len(changes.Unchanged) != 2 {
+		t.Errorf("Apply() of the current hosts = %+v, want no changes", changes)
+	}
+	if len(s.ChangeSets) != 2 {
+		t.Errorf("len(ChangeSets) = %d, want 2", len(s.ChangeSets))
+	}
+
+	s.Err = errors.New("boom")
+	if _, err := s.Apply(context.Background(), nil); err != s.Err {
+		t.Errorf("Apply() error = %v, want %v", err, s.Err)
+	}
+	if len(s.Hosts) != 2 {
+		t.Errorf("failed Apply() changed Hosts to %v", s.Hosts)
+	}
+}
+
+func TestFormatHosts(t *testing.T) {
+	hosts := []host.Host{
+		{Name: "tv", IP: net.ParseIP("10.0.0.7")},
+		{Name: "nas", IP: net.ParseIP("10.0.0.9")},
+		{Name: "nas", IP: net.ParseIP("10.0.0.5")},
+	}
+
+	got := string(hosttest.FormatHosts(hosts))
+	want := "10.0.0.5 nas\n10.0.0.9 nas\n10.0.0.7 tv\n"
+	if got != want {
+		t.Errorf("FormatHosts() = %q, want %q", got, want)
+	}
+	if hosts[0].Name != "tv" {
+		t.Errorf("FormatHosts() reordered its argument")
+	}
+}
+
+func TestGolden(t *testing.T) {
+	hosttest.GoldenHosts(t, filepath.Join("testdata", "hosts.golden"), []host.Host{
+		{Name: "printer", IP: net.ParseIP("10.0.0.6")},
+		{Name: "nas", IP: net.ParseIP("10.0.0.5")},
+	})
+}
+
+func TestGoldenMismatch(t *testing.T) {
+	r := &recorder{TB: t}
+	hosttest.Golden(r, filepath.Join("testdata", "hosts.golden"), []byte("10.0.0.1 router\n"))
+	if !r.failed {
+		t.Errorf("Golden() accepted output differing from the golden file")
+	}
+}
+
+func TestGoldenUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hosttest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "out.golden")
+	os.Setenv(hosttest.UpdateGoldenEnv, "1")
+	hosttest.Golden(t, path, []byte("updated\n"))
+	os.Unsetenv(hosttest.UpdateGoldenEnv)
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("golden file was not written: %v", err)
+	}
+	if string(got) != "updated\n" {
+		t.Errorf("golden file = %q, want %q", got, "updated\n")
+	}
+}
+
+func TestNewTLSServer(t *testing.T) {
+	server := hosttest.NewTLSServer(t, map[string]string{
+		"/api/edge/data.json?data=dhcp_leases": "leases",
+		"/api/edge/get.json":                   "config",
+	})
+	defer server.Close()
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"/api/edge/data.json?data=dhcp_leases", http.StatusOK, "leases"},
+		{"/api/edge/get.json", http.StatusOK, "config"},
+		{"/api/edge/get.json?ignored=1", http.StatusOK, "config"},
+		{"/api/edge/data.json?data=other", http.StatusNotFound, ""},
+		{"/missing", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := server.Client().Get(server.URL + tt.path)
+			if err != nil {
+				t.Fatalf("GET error = %v", err)
+			}
+			defer resp.Body.Close()
+
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && string(body) != tt.wantBody {
+				t.Errorf("body = %q, want %q", body, tt.wantBody)
+			}
+		})
+	}
+}
+
+// recorder is a testing.TB that records errors instead of failing the test,
+// for checking that helpers report them.
+type recorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.failed = true
+}
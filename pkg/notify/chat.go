@@ -0,0 +1,124 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"text/template"
+)
+
+// DefaultTemplate is the text/template the chat notifiers render their
+// message from unless given another. Templates are executed with a Payload.
+const DefaultTemplate = `dhcp-hosts-updater on {{.Source}}
+{{range .NewDevices}}unknown device: {{.MAC}}{{with .Hostname}} ({{.}}){{end}} at {{.IP}}
+{{end}}{{range .Added}}new: {{.Hostname}} at {{.IP}}{{with .MAC}} ({{.}}){{end}}
+{{end}}{{range .Updated}}moved: {{.Hostname}} from {{.OldIP}} to {{.IP}}
+{{end}}{{range .Removed}}removed: {{.Hostname}} at {{.IP}}
+{{end}}`
+
+var defaultTemplate = template.Must(ParseTemplate(DefaultTemplate))
+
+// ParseTemplate parses a message template for the chat notifiers.
+func ParseTemplate(text string) (*template.Template, error) {
+	return template.New("message").Parse(text)
+}
+
+// render executes t, or the default template when t is nil, with p.
+func render(t *template.Template, p Payload) (string, error) {
+	if t == nil {
+		t = defaultTemplate
+	}
+
+	var buf bytes.Buffer
+	err := t.Execute(&buf, p)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Slack is a Notifier posting a message to a Slack incoming webhook.
+type Slack struct {
+	WebhookURL string
+	// Template renders the message, DefaultTemplate when nil.
+	Template *template.Template
+	// Client is the HTTP client the request is made with. When nil a client
+	// with a 30 second timeout is used.
+	Client *http.Client
+}
+
+// Notify implements Notifier.
+func (s *Slack) Notify(ctx context.Context, p Payload) error {
+	text, err := render(s.Template, p)
+	if err != nil {
+		return err
+	}
+
+	return postJSON(ctx, s.Client, s.WebhookURL, map[string]string{"text": text})
+}
+
+// Discord is a Notifier posting a message to a Discord webhook.
+type Discord struct {
+	WebhookURL string
+	// Template renders the message, DefaultTemplate when nil.
+	Template *template.Template
+	// Client is the HTTP client the request is made with. When nil a client
+	// with a 30 second timeout is used.
+	Client *http.Client
+}
+
+// Notify implements Notifier.
+func (d *Discord) Notify(ctx context.Context, p Payload) error {
+	text, err := render(d.Template, p)
+	if err != nil {
+		return err
+	}
+
+	return postJSON(ctx, d.Client, d.WebhookURL, map[string]string{"content": text})
+}
+
+// TelegramAPIURL is the default base URL of the Telegram Bot API.
+const TelegramAPIURL = "https://api.telegram.org"
+
+// Telegram is a Notifier sending a message to a Telegram chat through a bot.
+type Telegram struct {
+	// Token is the bot's API token.
+	Token string
+	// ChatID identifies the chat to send to, or is the @username of a
+	// channel.
+	ChatID string
+	// APIURL is the base URL of the Bot API, TelegramAPIURL when empty.
+	APIURL string
+	// Template renders the message, DefaultTemplate when nil.
+	Template *template.Template
+	// Client is the HTTP client the request is made with. When nil a client
+	// with a 30 second timeout is used.
+	Client *http.Client
+}
+
+// Notify implements Notifier.
+func (t *Telegram) Notify(ctx context.Context, p Payload) error {
+	text, err := render(t.Template, p)
+	if err != nil {
+		return err
+	}
+
+	apiURL := t.APIURL
+	if apiURL == "" {
+		apiURL = TelegramAPIURL
+	}
+
+	err = postJSON(ctx, t.Client, strings.TrimSuffix(apiURL, "/")+"/bot"+t.Token+"/sendMessage", map[string]string{
+		"chat_id": t.ChatID,
+		"text":    text,
+	})
+	if err != nil && t.Token != "" {
+		// The token is part of the URL, keep it out of logs.
+		return errors.New(strings.Replace(err.Error(), t.Token, "<token>", -1))
+	}
+
+	return err
+}
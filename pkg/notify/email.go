@@ -0,0 +1,190 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// SMTPSecurity is how an Email notifier protects its connection to the SMTP
+// server.
+type SMTPSecurity string
+
+// The supported SMTP connection security modes.
+const (
+	// SMTPStartTLS upgrades a plain connection with STARTTLS and fails if
+	// the server does not offer it. This is the default, usually on port 587.
+	SMTPStartTLS SMTPSecurity = "starttls"
+	// SMTPTLS speaks TLS from the start, usually on port 465.
+	SMTPTLS SMTPSecurity = "tls"
+	// SMTPNone sends the message unencrypted. Authentication is then refused
+	// unless the server is on localhost.
+	SMTPNone SMTPSecurity = "none"
+)
+
+// ParseSMTPSecurity returns the SMTPSecurity named s.
+func ParseSMTPSecurity(s string) (SMTPSecurity, error) {
+	switch security := SMTPSecurity(s); security {
+	case SMTPStartTLS, SMTPTLS, SMTPNone:
+		return security, nil
+	default:
+		return "", fmt.Errorf("unknown SMTP security %q, must be %s, %s, or %s", s, SMTPStartTLS, SMTPTLS, SMTPNone)
+	}
+}
+
+// Email is a Notifier sending a plain text email through an SMTP server.
+type Email struct {
+	// Addr is the host:port of the SMTP server.
+	Addr string
+	// Security protects the connection, SMTPStartTLS when empty.
+	Security SMTPSecurity
+	// Username and Password authenticate with PLAIN auth when Username is
+	// set.
+	Username string
+	Password string
+	From     string
+	To       []string
+	// Template renders the message body, DefaultTemplate when nil.
+	Template *template.Template
+	// Timeout bounds the whole exchange with the server, 30 seconds when
+	// zero.
+	Timeout time.Duration
+}
+
+// Notify implements Notifier.
+func (e *Email) Notify(ctx context.Context, p Payload) error {
+	body, err := render(e.Template, p)
+	if err != nil {
+		return err
+	}
+
+	host, _, err := net.SplitHostPort(e.Addr)
+	if err != nil {
+		return err
+	}
+
+	timeout := e.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", e.Addr)
+	if err != nil {
+		return err
+	}
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	tlsConfig := &tls.Config{ServerName: host}
+	if e.Security == SMTPTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if e.Security == "" || e.Security == SMTPStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS", e.Addr)
+		}
+
+		err = c.StartTLS(tlsConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	if e.Username != "" {
+		err = c.Auth(smtp.PlainAuth("", e.Username, e.Password, host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.Mail(e.From)
+	if err != nil {
+		return err
+	}
+	for _, to := range e.To {
+		err = c.Rcpt(to)
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(e.message(p, body))
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+// message returns the email holding body, with a subject summarizing p.
+func (e *Email) message(p Payload, body string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", e.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject(p)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", p.Time.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+	buf.WriteString("\r\n")
+
+	return buf.Bytes()
+}
+
+// subject summarizes p in a line such as "dhcp-hosts-updater on nas: 2 added,
+// 1 new device".
+func subject(p Payload) string {
+	var parts []string
+	for _, count := range []struct {
+		n    int
+		what string
+	}{
+		{len(p.NewDevices), "new device"},
+		{len(p.Added), "added"},
+		{len(p.Updated), "moved"},
+		{len(p.Removed), "removed"},
+	} {
+		if count.n == 0 {
+			continue
+		}
+		what := count.what
+		if count.n > 1 && what == "new device" {
+			what += "s"
+		}
+		parts = append(parts, fmt.Sprintf("%d %s", count.n, what))
+	}
+
+	if len(parts) == 0 {
+		return "dhcp-hosts-updater on " + p.Source
+	}
+
+	return "dhcp-hosts-updater on " + p.Source + ": " + strings.Join(parts, ", ")
+}
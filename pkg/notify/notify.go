@@ -0,0 +1,81 @@
+// Package notify tells other systems about the changes the updater made to
+// the hosts file, e.g. to announce that a new device joined the network.
+package notify
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/host"
+)
+
+// Notifier sends a notification about changes made to the hosts file and
+// devices seen for the first time.
+type Notifier interface {
+	Notify(ctx context.Context, p Payload) error
+}
+
+// Host is a host in a Payload.
+type Host struct {
+	Hostname string `json:"hostname"`
+	IP       string `json:"ip"`
+	OldIP    string `json:"old_ip,omitempty"`
+	MAC      string `json:"mac,omitempty"`
+}
+
+// Payload describes the changes made by a run, and the devices it saw for the
+// first time, in a form suited to being sent as JSON. The host lists are never
+// null.
+type Payload struct {
+	// Time is when the changes were made.
+	Time time.Time `json:"time"`
+	// Source is the hostname of the machine whose hosts file changed.
+	Source  string `json:"source"`
+	Added   []Host `json:"added"`
+	Updated []Host `json:"updated"`
+	Removed []Host `json:"removed"`
+	// NewDevices lists the hosts whose MAC had never been seen before,
+	// whether or not they have a hostname.
+	NewDevices []Host `json:"new_devices"`
+}
+
+// Empty reports whether there is nothing to notify about.
+func (p Payload) Empty() bool {
+	return len(p.Added) == 0 && len(p.Updated) == 0 && len(p.Removed) == 0 && len(p.NewDevices) == 0
+}
+
+// NewPayload returns the Payload describing changes, without new devices.
+func NewPayload(changes host.ChangeSet) Payload {
+	source, _ := os.Hostname()
+	p := Payload{
+		Time:       time.Now(),
+		Source:     source,
+		Added:      []Host{},
+		Updated:    []Host{},
+		Removed:    []Host{},
+		NewDevices: []Host{},
+	}
+
+	for _, change := range changes.Changes {
+		h := Host{
+			Hostname: change.Host.Name,
+			IP:       change.Host.IP.String(),
+			MAC:      change.Host.MAC,
+		}
+		if change.OldIP != nil {
+			h.OldIP = change.OldIP.String()
+		}
+
+		switch change.Action {
+		case host.ActionAdd:
+			p.Added = append(p.Added, h)
+		case host.ActionUpdate:
+			p.Updated = append(p.Updated, h)
+		case host.ActionRemove:
+			p.Removed = append(p.Removed, h)
+		}
+	}
+
+	return p
+}
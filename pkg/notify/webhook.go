@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Webhook is a Notifier that POSTs the Payload as JSON to a URL.
+type Webhook struct {
+	URL string
+	// Client is the HTTP client the request is made with. When nil a client
+	// with a 30 second timeout is used.
+	Client *http.Client
+}
+
+// Notify implements Notifier. Any response status other than 2xx is an error.
+func (w *Webhook) Notify(ctx context.Context, p Payload) error {
+	return postJSON(ctx, w.Client, w.URL, p)
+}
+
+// postJSON POSTs body encoded as JSON to url.
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected response status %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+var (
+	// ErrAuthFailed is returned when a provider rejects its credentials.
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrUnknownProvider is returned when no provider is registered under
+	// the requested name.
+	ErrUnknownProvider = errors.New("unknown provider")
+	// ErrMissingFlag is returned when a provider's required flags are not
+	// set.
+	ErrMissingFlag = errors.New("missing required flag")
+	// ErrUnknownFlag is returned when a flag is passed to a provider that
+	// does not declare it.
+	ErrUnknownFlag = errors.New("unknown flag")
+	// ErrUnavailable is wrapped by errors from a provider that is expected
+	// to recover by itself, such as a router answering with a 5xx status
+	// while it restarts, so that IsTransient reports them as retryable.
+	ErrUnavailable = errors.New("temporarily unavailable")
+)
+
+// IsTransient reports whether err is likely to go away if the request is
+// retried: the provider was unavailable, the connection was refused or
+// reset, or it timed out.
+func IsTransient(err error) bool {
+	if errors.Is(err, ErrUnavailable) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Error wraps an error returned by a provider with the provider's name.
+type Error struct {
+	Provider string
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Provider, e.Err)
+}
+
+// Unwrap returns the error returned by the provider.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Validate checks that every required flag of the provider is set and that
+// no undeclared flags are. Missing flags are reported before unknown ones,
+// each error listing all offending flags namespaced by the provider name.
+func (d Definition) Validate(flags map[string]string) error {
+	var missing []string
+	for _, name := range d.RequiredFlags {
+		if flags[name] == "" {
+			missing = append(missing, d.Name+"."+name)
+		}
+	}
+
+	if len(missing) != 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("%w: %s", ErrMissingFlag, strings.Join(missing, ", "))
+	}
+
+	var unknown []string
+	for name := range flags {
+		if _, ok := d.Flags[name]; !ok {
+			unknown = append(unknown, d.Name+"."+name)
+		}
+	}
+
+	if len(unknown) != 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("%w: %s", ErrUnknownFlag, strings.Join(unknown, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package provider
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// The timeouts of clients created by NewHTTPClient. They are generous for a
+// router on the local network but stop one that accepts the connection and
+// never answers from hanging the updater.
+const (
+	DefaultDialTimeout           = 10 * time.Second
+	DefaultTLSHandshakeTimeout   = 10 * time.Second
+	DefaultResponseHeaderTimeout = 30 * time.Second
+	DefaultRequestTimeout        = time.Minute
+)
+
+// NewHTTPClient returns the HTTP client providers should use by default,
+// connecting with tlsConfig through proxy and bounded by the default timeouts.
+// A nil tlsConfig uses the standard library's defaults and a nil proxy uses
+// the proxy set by the HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment
+// variables, if any. Besides the http, https, and socks5 proxies supported by
+// net/http, proxy may be an ssh://user@host:port URL to tunnel connections
+// through an SSH jump host with the ssh client. Requests made with a context
+// are also cancelled when it is done.
+func NewHTTPClient(tlsConfig *tls.Config, proxy *url.URL) *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   DefaultDialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   DefaultTLSHandshakeTimeout,
+		ResponseHeaderTimeout: DefaultResponseHeaderTimeout,
+		IdleConnTimeout:       90 * time.Second,
+	}
+
+	switch {
+	case proxy != nil && proxy.Scheme == "ssh":
+		transport.Proxy = nil
+		transport.DialContext = sshDialer{jumpHost: proxy}.DialContext
+	case proxy != nil:
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   DefaultRequestTimeout,
+	}
+}
@@ -0,0 +1,180 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// PluginFlagEnvPrefix prefixes the environment variables a plugin receives its
+// flag values in. The flag name is upper cased with dashes and dots replaced by
+// underscores, so the "api-key" flag is passed as
+// DHCP_HOSTS_UPDATER_FLAG_API_KEY.
+const PluginFlagEnvPrefix = "DHCP_HOSTS_UPDATER_FLAG_"
+
+// PluginExitTempFail is the exit status, EX_TEMPFAIL from sysexits.h, a
+// plugin exits with when its router is temporarily unavailable.
+const PluginExitTempFail = 75
+
+// pluginHost is a host in the list form of a plugin's hosts output.
+type pluginHost struct {
+	Name    string `json:"name"`
+	IP      string `json:"ip"`
+	MAC     string `json:"mac"`
+	Static  bool   `json:"static"`
+	Network string `json:"network"`
+}
+
+// pluginDescription is what a plugin prints as JSON when run with the
+// "describe" argument.
+type pluginDescription struct {
+	Flags         map[string]string `json:"flags"`
+	RequiredFlags []string          `json:"required_flags"`
+}
+
+// RegisterPlugins registers every executable in dir as a provider named after
+// the executable, without its extension. Plugins speak a small protocol over
+// their arguments, environment, and stdout:
+//
+//	plugin describe  prints {"flags": {"name": "usage"}, "required_flags": ["name"]}
+//	plugin hosts     prints {"hostname": "ip"} for every host the plugin knows of,
+//	                 or [{"name": "hostname", "ip": "ip", "mac": "mac", "static": true,
+//	                 "network": "name"}] to also report MACs, fixed addresses,
+//	                 and networks
+//	plugin check     exits zero if the plugin can reach its router
+//
+// Flag values are passed to hosts and check in environment variables, see
+// PluginFlagEnvPrefix. A non-zero exit status is treated as an error and
+// whatever the plugin wrote to stderr is included in the error. Plugins exit
+// with PluginExitTempFail to report a failure worth retrying.
+func RegisterPlugins(dir string) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.Mode().IsRegular() || entry.Mode().Perm()&0111 == 0 {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if _, exists := Lookup(name); exists {
+			return fmt.Errorf("plugin %s conflicts with an already registered provider", path)
+		}
+
+		out, err := runPlugin(context.Background(), path, "describe", nil)
+		if err != nil {
+			return err
+		}
+
+		description := pluginDescription{}
+		err = json.Unmarshal(out, &description)
+		if err != nil {
+			return fmt.Errorf("could not decode description of plugin %s: %v", path, err)
+		}
+
+		Register(Definition{
+			Name:          name,
+			Flags:         description.Flags,
+			RequiredFlags: description.RequiredFlags,
+			New: func(flags map[string]string, opts Options) (HostsProvider, error) {
+				return &pluginHostsProvider{path: path, flags: flags, logger: opts.Logger}, nil
+			},
+		})
+	}
+
+	return nil
+}
+
+// pluginHostsProvider is a HostsProvider backed by a plugin executable.
+type pluginHostsProvider struct {
+	path   string
+	flags  map[string]string
+	logger *log.Logger
+}
+
+func (p *pluginHostsProvider) GetHosts(ctx context.Context) ([]Host, error) {
+	out, err := runPlugin(ctx, p.path, "hosts", p.flags)
+	if err != nil {
+		return nil, err
+	}
+
+	toReturn, err := decodePluginHosts(out)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode hosts from plugin %s: %v", p.path, err)
+	}
+
+	p.logger.Printf("plugin %s returned %d hosts", p.path, len(toReturn))
+
+	return toReturn, nil
+}
+
+// decodePluginHosts decodes either form of a plugin's hosts output. IPs are
+// parsed leniently so one bad entry does not fail the others.
+func decodePluginHosts(out []byte) ([]Host, error) {
+	var decoded []pluginHost
+	if trimmed := bytes.TrimSpace(out); len(trimmed) > 0 && trimmed[0] == '[' {
+		err := json.Unmarshal(trimmed, &decoded)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		byName := map[string]string{}
+		err := json.Unmarshal(out, &byName)
+		if err != nil {
+			return nil, err
+		}
+
+		for name, ip := range byName {
+			decoded = append(decoded, pluginHost{Name: name, IP: ip})
+		}
+	}
+
+	toReturn := make([]Host, 0, len(decoded))
+	for _, h := range decoded {
+		toReturn = append(toReturn, Host{Name: h.Name, IP: net.ParseIP(h.IP), MAC: h.MAC, Static: h.Static, Network: h.Network})
+	}
+
+	return toReturn, nil
+}
+
+func (p *pluginHostsProvider) Check(ctx context.Context) error {
+	_, err := runPlugin(ctx, p.path, "check", p.flags)
+	return err
+}
+
+// runPlugin runs the plugin at path with command as its only argument and
+// flags in its environment, returning what it wrote to stdout.
+func runPlugin(ctx context.Context, path, command string, flags map[string]string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, path, command)
+	cmd.Env = os.Environ()
+	for name, value := range flags {
+		envName := strings.NewReplacer("-", "_", ".", "_").Replace(strings.ToUpper(name))
+		cmd.Env = append(cmd.Env, PluginFlagEnvPrefix+envName+"="+value)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == PluginExitTempFail {
+			err = ErrUnavailable
+		}
+		return nil, fmt.Errorf("plugin %s %s failed: %w: %s", path, command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
@@ -0,0 +1,211 @@
+// Package provider holds the registry of hosts providers available to the
+// updater. Providers register themselves, usually from an init function, so
+// that a binary can compile in additional providers by importing their
+// packages. The command line builds its flags and provider list from the
+// registry.
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// Host is a host as reported by a provider. Providers report what they were
+// given without validating it, a nil IP or malformed MAC is rejected later.
+type Host struct {
+	Name string `json:"name"`
+	IP   net.IP `json:"ip"`
+	// MAC is the host's hardware address as reported by the provider, empty
+	// if unknown.
+	MAC string `json:"mac,omitempty"`
+	// Static is set for hosts with a fixed address, e.g. DHCP static
+	// mappings, rather than a dynamic lease.
+	Static bool `json:"static,omitempty"`
+	// Network names the network or VLAN the host is on, if known.
+	Network string `json:"network,omitempty"`
+}
+
+// HostsProvider is a source of hostname to IP mappings, usually a router.
+type HostsProvider interface {
+	// GetHosts returns the hosts known to the provider. A hostname may
+	// appear more than once, the last occurrence wins.
+	GetHosts(ctx context.Context) ([]Host, error)
+	// Check performs a lightweight authenticated call to verify the provider
+	// is reachable and its credentials are valid.
+	Check(ctx context.Context) error
+}
+
+// Definition describes a provider that can be enabled from the command line.
+type Definition struct {
+	// Name identifies the provider and namespaces its flags, e.g. the
+	// "address" flag of the "edgeos" provider is -edgeos.address.
+	Name string
+	// Flags maps the provider's flag names to their usage.
+	Flags map[string]string
+	// RequiredFlags lists the flags that must be set to use the provider.
+	RequiredFlags []string
+	// New creates the provider from its flag values keyed by flag name.
+	New func(flags map[string]string, opts Options) (HostsProvider, error)
+}
+
+// Options carries the dependencies a provider should use instead of its own
+// defaults.
+type Options struct {
+	// Context bounds the work a provider does while it is created, such as
+	// logging in. It is never nil when passed to Definition.New.
+	Context context.Context
+	// Logger receives the provider's log output. It is never nil when
+	// passed to Definition.New.
+	Logger *log.Logger
+	// HTTPClient returns the client a provider should make requests with.
+	// When nil the provider uses its own default client.
+	HTTPClient func() *http.Client
+	// Proxy is the proxy a provider's default client should connect
+	// through. When nil the proxy environment variables are honored.
+	Proxy *url.URL
+	// Transport, when set, wraps the transport of the HTTP client a
+	// provider makes requests with, whether its own or one from
+	// HTTPClient.
+	Transport func(http.RoundTripper) http.RoundTripper
+	// Sessions, when set, is where a provider that logs in should keep its
+	// session so that later runs can resume it.
+	Sessions SessionStore
+}
+
+// Option configures the Options passed to a provider by New.
+type Option func(*Options)
+
+// WithContext sets the context bounding the creation of a provider, e.g. the
+// timeout of a connection attempt. By default it is context.Background().
+func WithContext(ctx context.Context) Option {
+	return func(o *Options) {
+		o.Context = ctx
+	}
+}
+
+// WithLogger sets the logger a provider logs to. By default nothing is
+// logged.
+func WithLogger(logger *log.Logger) Option {
+	return func(o *Options) {
+		o.Logger = logger
+	}
+}
+
+// WithProxy sets the proxy a provider's default HTTP client connects through,
+// for routers only reachable through a jump proxy. An ssh:// URL tunnels
+// through an SSH jump host, see NewHTTPClient.
+func WithProxy(proxy *url.URL) Option {
+	return func(o *Options) {
+		o.Proxy = proxy
+	}
+}
+
+// WithHTTPClient sets the function a provider calls to create its HTTP client,
+// e.g. to route requests through a proxy or instrument them.
+func WithHTTPClient(factory func() *http.Client) Option {
+	return func(o *Options) {
+		o.HTTPClient = factory
+	}
+}
+
+// WithTransport sets a function wrapping the transport of a provider's HTTP
+// client, e.g. RateLimiter.Transport to space out its requests.
+func WithTransport(wrap func(http.RoundTripper) http.RoundTripper) Option {
+	return func(o *Options) {
+		o.Transport = wrap
+	}
+}
+
+// WithSessionStore sets where providers keep their login sessions between
+// runs. By default every run logs in anew.
+func WithSessionStore(store SessionStore) Option {
+	return func(o *Options) {
+		o.Sessions = store
+	}
+}
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]Definition{}
+)
+
+// Register makes a provider available under its name. It panics if the
+// definition has no name or New function, or if a provider has already been
+// registered with the same name.
+func Register(d Definition) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if d.Name == "" {
+		panic("provider: Register called with an empty name")
+	}
+
+	if d.New == nil {
+		panic(fmt.Sprintf("provider: Register called without New for %s", d.Name))
+	}
+
+	if _, exists := registry[d.Name]; exists {
+		panic(fmt.Sprintf("provider: Register called twice for %s", d.Name))
+	}
+
+	registry[d.Name] = d
+}
+
+// New creates the provider registered under name from its flag values after
+// validating them. Any error from the provider is wrapped in an *Error.
+func New(name string, flags map[string]string, opts ...Option) (HostsProvider, error) {
+	d, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+
+	err := d.Validate(flags)
+	if err != nil {
+		return nil, err
+	}
+
+	options := Options{
+		Context: context.Background(),
+		Logger:  log.New(ioutil.Discard, "", 0),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	p, err := d.New(flags, options)
+	if err != nil {
+		return nil, &Error{Provider: name, Err: err}
+	}
+
+	return p, nil
+}
+
+// Lookup returns the provider registered under name.
+func Lookup(name string) (Definition, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	d, ok := registry[name]
+	return d, ok
+}
+
+// Names returns the names of all registered providers, sorted.
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
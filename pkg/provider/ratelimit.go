@@ -0,0 +1,82 @@
+package provider
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces out the HTTP requests made through the transports it
+// wraps, so that frequent updates cannot overload a small router. A provider
+// should be given the same RateLimiter every time it is created, as the
+// interval is only enforced between requests through it.
+type RateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewRateLimiter returns a RateLimiter starting requests at least interval
+// apart.
+func NewRateLimiter(interval time.Duration) *RateLimiter {
+	return &RateLimiter{interval: interval}
+}
+
+// Transport wraps next so that every request through it, including logins
+// and retries, waits for its turn. A nil next uses http.DefaultTransport.
+// It can be passed to WithTransport.
+func (l *RateLimiter) Transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &rateLimitedTransport{limiter: l, next: next}
+}
+
+// wait blocks until the next request may start or ctx is done. Each caller
+// reserves its slot before waiting so concurrent requests are spaced out too.
+func (l *RateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	start := l.next
+	if start.Before(now) {
+		start = now
+	}
+	l.next = start.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := start.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type rateLimitedTransport struct {
+	limiter *RateLimiter
+	next    http.RoundTripper
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	err := t.limiter.wait(req.Context())
+	if err != nil {
+		// A RoundTripper closes the body even when it fails.
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	const interval = 50 * time.Millisecond
+	limiter := NewRateLimiter(interval)
+
+	// Clients sharing the limiter, as a provider does across reconnects,
+	// are spaced out together.
+	clients := []*http.Client{
+		{Transport: limiter.Transport(nil)},
+		{Transport: limiter.Transport(nil)},
+	}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		resp, err := clients[i%len(clients)].Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if elapsed := time.Since(start); elapsed < 2*interval {
+		t.Errorf("3 requests took %v, want at least %v", elapsed, 2*interval)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = clients[0].Do(req)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("request waiting for its turn with a cancelled context: error = %v, want %v", err, context.Canceled)
+	}
+}
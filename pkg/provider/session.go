@@ -0,0 +1,155 @@
+package provider
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/grounded042/dhcp-hosts-updater/internal/atomicfile"
+)
+
+// SessionStore keeps provider sessions, such as login cookies, between runs
+// so that a provider can resume its session instead of logging in again.
+// Sessions are encrypted with a secret only the provider knows, typically its
+// password, so that they are useless to whoever reads the store without it.
+type SessionStore interface {
+	// Load returns the session saved under key, or nil if there is none or
+	// it was not saved with secret.
+	Load(key, secret string) ([]byte, error)
+	// Save replaces the session saved under key.
+	Save(key, secret string, session []byte) error
+}
+
+// FileSessionStore is a SessionStore keeping each session in a file in Dir,
+// encrypted with AES-GCM under a key derived from the secret with
+// PBKDF2-HMAC-SHA256, which is deliberately slow so that the secret cannot be
+// guessed quickly from a stolen session file. Dir is created, readable by its
+// owner only, when first written to.
+type FileSessionStore struct {
+	Dir string
+}
+
+const (
+	sessionSaltSize = 16
+	// sessionKDFIterations is the PBKDF2 iteration count, as recommended by
+	// OWASP for HMAC-SHA256.
+	sessionKDFIterations = 600000
+)
+
+// Load implements SessionStore.
+func (s *FileSessionStore) Load(key, secret string) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < sessionSaltSize {
+		return nil, nil
+	}
+	aead, err := sessionCipher(secret, data[:sessionSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	data = data[sessionSaltSize:]
+
+	if len(data) < aead.NonceSize() {
+		return nil, nil
+	}
+	session, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(key))
+	if err != nil {
+		// Saved with another secret, e.g. before a password change.
+		return nil, nil
+	}
+
+	return session, nil
+}
+
+// Save implements SessionStore.
+func (s *FileSessionStore) Save(key, secret string, session []byte) error {
+	err := os.MkdirAll(s.Dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	salt := make([]byte, sessionSaltSize)
+	_, err = io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return err
+	}
+	aead, err := sessionCipher(secret, salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return err
+	}
+
+	data := append(salt, nonce...)
+	data = aead.Seal(data, nonce, session, []byte(key))
+
+	return atomicfile.WriteFile(s.path(key), data, 0600)
+}
+
+// path names the file of a session after a hash of its key, which may hold
+// addresses and usernames.
+func (s *FileSessionStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.Dir, hex.EncodeToString(sum[:])+".session")
+}
+
+// sessionCipher returns the AEAD sealing sessions under secret and salt.
+func sessionCipher(secret string, salt []byte) (cipher.AEAD, error) {
+	if secret == "" {
+		return nil, errors.New("sessions cannot be stored without a secret")
+	}
+
+	key := pbkdf2SHA256([]byte(secret), salt, sessionKDFIterations, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2SHA256 derives a keyLen byte key from password and salt with
+// PBKDF2 (RFC 8018) using HMAC-SHA256.
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	blocks := (keyLen + prf.Size() - 1) / prf.Size()
+
+	var key []byte
+	u := make([]byte, 0, prf.Size())
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u = prf.Sum(u[:0])
+
+		t := append([]byte(nil), u...)
+		for n := 1; n < iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range t {
+				t[i] ^= u[i]
+			}
+		}
+		key = append(key, t...)
+	}
+
+	return key[:keyLen]
+}
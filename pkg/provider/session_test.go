@@ -0,0 +1,79 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func TestPBKDF2SHA256(t *testing.T) {
+	// The first two test vectors are from RFC 7914, section 11.
+	tests := []struct {
+		password, salt string
+		iterations     int
+		keyLen         int
+		want           string
+	}{
+		{"passwd", "salt", 1, 64, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, 64, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+		{"password", "salt", 4096, 32, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2SHA256([]byte(tt.password), []byte(tt.salt), tt.iterations, tt.keyLen))
+		if got != tt.want {
+			t.Errorf("pbkdf2SHA256(%q, %q, %d, %d) = %s, want %s", tt.password, tt.salt, tt.iterations, tt.keyLen, got, tt.want)
+		}
+	}
+}
+
+func TestFileSessionStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := &FileSessionStore{Dir: dir}
+
+	session := []byte(`[{"name":"PHPSESSID","value":"abc"}]`)
+	err = s.Save("edgeos ubnt https://router/", "secret", session)
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, err := s.Load("edgeos ubnt https://router/", "secret")
+	if err != nil || !bytes.Equal(got, session) {
+		t.Errorf("Load() = %q, %v, want %q", got, err, session)
+	}
+
+	raw, err := ioutil.ReadFile(s.path("edgeos ubnt https://router/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("PHPSESSID")) {
+		t.Errorf("session file holds the session in the clear")
+	}
+	info, err := os.Stat(s.path("edgeos ubnt https://router/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("session file has mode %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+	}
+
+	for _, tt := range []struct{ key, secret string }{
+		{"edgeos ubnt https://router/", "other"},
+		{"edgeos admin https://router/", "secret"},
+	} {
+		got, err := s.Load(tt.key, tt.secret)
+		if err != nil || got != nil {
+			t.Errorf("Load(%q, %q) = %q, %v, want no session", tt.key, tt.secret, got, err)
+		}
+	}
+
+	if err := s.Save("key", "", session); err == nil {
+		t.Errorf("Save() without a secret succeeded")
+	}
+}
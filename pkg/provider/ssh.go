@@ -0,0 +1,160 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// sshDialer connects through an SSH jump host given by an ssh:// proxy URL,
+// such as ssh://admin@bastion:2222. It runs the ssh client with -W, as
+// OpenSSH's ProxyJump does, so the user's ssh configuration, keys, and agent
+// are used. Password prompts are disabled as nobody is there to answer them.
+type sshDialer struct {
+	jumpHost *url.URL
+}
+
+// DialContext connects to addr through the jump host. Only TCP is supported.
+// It returns once ssh started, errors connecting to the jump host or from it
+// to addr are returned by the first read.
+func (d sshDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if network != "tcp" && network != "tcp4" && network != "tcp6" {
+		return nil, fmt.Errorf("ssh: unsupported network %s", network)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"-W", addr,
+		"-o", "BatchMode=yes",
+		"-o", "ConnectTimeout=" + strconv.Itoa(int(DefaultDialTimeout/time.Second)),
+	}
+	if port := d.jumpHost.Port(); port != "" {
+		args = append(args, "-p", port)
+	}
+	dest := d.jumpHost.Hostname()
+	if d.jumpHost.User != nil {
+		dest = d.jumpHost.User.Username() + "@" + dest
+	}
+	args = append(args, "--", dest)
+
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		stdoutR.Close()
+		stdoutW.Close()
+		return nil, err
+	}
+
+	c := &sshConn{
+		stdout: stdoutR,
+		stdin:  stdinW,
+		local:  sshAddr("ssh"),
+		remote: sshAddr(addr),
+		done:   make(chan struct{}),
+	}
+	c.cmd = exec.Command("ssh", args...)
+	c.cmd.Stdin = stdinR
+	c.cmd.Stdout = stdoutW
+	c.cmd.Stderr = &c.stderr
+
+	err = c.cmd.Start()
+	stdinR.Close()
+	stdoutW.Close()
+	if err != nil {
+		stdoutR.Close()
+		stdinW.Close()
+		return nil, fmt.Errorf("ssh: %v", err)
+	}
+	go func() {
+		c.waitErr = c.cmd.Wait()
+		close(c.done)
+	}()
+
+	return c, nil
+}
+
+// sshConn is a net.Conn over the stdin and stdout of an ssh -W process.
+type sshConn struct {
+	cmd    *exec.Cmd
+	stdin  *os.File
+	stdout *os.File
+	stderr bytes.Buffer
+	local  net.Addr
+	remote net.Addr
+
+	// done is closed once ssh exited, with waitErr set.
+	done    chan struct{}
+	waitErr error
+
+	closeOnce sync.Once
+}
+
+// Read implements net.Conn. Once ssh exits, what it printed on stderr, such
+// as why it could not connect, is returned as the error.
+func (c *sshConn) Read(b []byte) (int, error) {
+	n, err := c.stdout.Read(b)
+	if err != io.EOF || n > 0 {
+		return n, err
+	}
+
+	select {
+	case <-c.done:
+	case <-time.After(time.Second):
+		return 0, io.EOF
+	}
+	if msg := bytes.TrimSpace(c.stderr.Bytes()); c.waitErr != nil && len(msg) > 0 {
+		return 0, fmt.Errorf("ssh: %s", msg)
+	}
+
+	return 0, io.EOF
+}
+
+func (c *sshConn) Write(b []byte) (int, error) {
+	return c.stdin.Write(b)
+}
+
+// Close implements net.Conn, stopping ssh.
+func (c *sshConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		c.cmd.Process.Kill()
+		<-c.done
+		c.stdout.Close()
+	})
+
+	return nil
+}
+
+func (c *sshConn) LocalAddr() net.Addr  { return c.local }
+func (c *sshConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *sshConn) SetDeadline(t time.Time) error {
+	err := c.stdout.SetReadDeadline(t)
+	if err != nil {
+		return err
+	}
+
+	return c.stdin.SetWriteDeadline(t)
+}
+
+func (c *sshConn) SetReadDeadline(t time.Time) error  { return c.stdout.SetReadDeadline(t) }
+func (c *sshConn) SetWriteDeadline(t time.Time) error { return c.stdin.SetWriteDeadline(t) }
+
+// sshAddr is the address of an end of an sshConn.
+type sshAddr string
+
+func (a sshAddr) Network() string { return "ssh" }
+func (a sshAddr) String() string  { return string(a) }
@@ -0,0 +1,134 @@
+// Package state persists what the updater learns across runs, such as the
+// devices it has seen and a history of recent runs, in a JSON state file.
+package state
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/grounded042/dhcp-hosts-updater/internal/atomicfile"
+	"github.com/grounded042/dhcp-hosts-updater/pkg/host"
+)
+
+// Device is a device, identified by its MAC, that a provider has reported.
+type Device struct {
+	MAC       string    `json:"mac"`
+	Hostname  string    `json:"hostname,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Run records the outcome of an update run.
+type Run struct {
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	// Fetched is the number of hosts fetched from each provider that
+	// succeeded.
+	Fetched map[string]int `json:"fetched,omitempty"`
+	Added   int            `json:"added"`
+	Updated int            `json:"updated"`
+	Removed int            `json:"removed"`
+	// Errors describes the failures of the run, such as providers that
+	// could not be reached.
+	Errors   []string `json:"errors,omitempty"`
+	ExitCode int      `json:"exit_code"`
+}
+
+// State is the content of the state file.
+type State struct {
+	// Devices are keyed by MAC in the form produced by net.HardwareAddr.
+	Devices map[string]*Device `json:"devices"`
+	// Runs lists the most recent runs, oldest first.
+	Runs []Run `json:"runs,omitempty"`
+}
+
+// Load reads the state file at path. A missing file yields an empty State.
+func Load(path string) (*State, error) {
+	s := &State{Devices: map[string]*Device{}}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, s)
+	if err != nil {
+		return nil, err
+	}
+	if s.Devices == nil {
+		s.Devices = map[string]*Device{}
+	}
+
+	return s, nil
+}
+
+// Save writes s to the state file at path, creating its directory if needed.
+// The state file is replaced atomically so a failed write never leaves a
+// truncated state file behind.
+func (s *State) Save(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(path, data, 0600)
+}
+
+// ObserveDevices records the MACs of hosts as seen at now and returns the
+// devices seen for the first time, in the order of hosts. Hosts without a
+// valid MAC are ignored, whether or not they have a name.
+func (s *State) ObserveDevices(hosts []host.Host, now time.Time) []Device {
+	var seen []Device
+	for _, h := range hosts {
+		mac, err := net.ParseMAC(h.MAC)
+		if err != nil {
+			continue
+		}
+
+		d, ok := s.Devices[mac.String()]
+		if !ok {
+			d = &Device{MAC: mac.String(), FirstSeen: now}
+			s.Devices[d.MAC] = d
+		}
+		d.LastSeen = now
+		if h.Name != "" {
+			d.Hostname = h.Name
+		}
+		if h.IP != nil {
+			d.IP = h.IP.String()
+		}
+
+		if !ok {
+			seen = append(seen, *d)
+		}
+	}
+
+	return seen
+}
+
+// RecordRun appends r to the run history, dropping the oldest runs so that at
+// most keep remain. With keep zero or less no history is kept.
+func (s *State) RecordRun(r Run, keep int) {
+	if keep <= 0 {
+		s.Runs = nil
+		return
+	}
+
+	s.Runs = append(s.Runs, r)
+	if len(s.Runs) > keep {
+		s.Runs = append([]Run(nil), s.Runs[len(s.Runs)-keep:]...)
+	}
+}
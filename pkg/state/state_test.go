@@ -0,0 +1,34 @@
+package state
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecordRun(t *testing.T) {
+	tests := []struct {
+		keep    int
+		records int
+		want    int
+	}{
+		{keep: 3, records: 2, want: 2},
+		{keep: 3, records: 5, want: 3},
+		{keep: 0, records: 2, want: 0},
+		{keep: -1, records: 2, want: 0},
+	}
+	for _, tt := range tests {
+		s := &State{}
+		start := time.Now()
+		for i := 0; i < tt.records; i++ {
+			s.RecordRun(Run{Start: start.Add(time.Duration(i) * time.Second)}, tt.keep)
+		}
+
+		if len(s.Runs) != tt.want {
+			t.Errorf("RecordRun(keep %d) %d times kept %d runs, want %d", tt.keep, tt.records, len(s.Runs), tt.want)
+			continue
+		}
+		if tt.want > 0 && !s.Runs[len(s.Runs)-1].Start.Equal(start.Add(time.Duration(tt.records-1)*time.Second)) {
+			t.Errorf("RecordRun(keep %d) dropped the latest run", tt.keep)
+		}
+	}
+}
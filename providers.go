@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/provider"
+)
+
+// providerFlags holds the values of every registered provider's flags, keyed
+// by provider name and then flag name. Flags are registered namespaced by the
+// provider name, e.g. -edgeos.address, so flags from different providers can't
+// collide.
+var providerFlags = map[string]map[string]*string{}
+
+// registerProviderFlags registers the namespaced flags of every registered
+// provider with fs.
+func registerProviderFlags(fs *flag.FlagSet) {
+	for _, name := range provider.Names() {
+		definition, _ := provider.Lookup(name)
+
+		providerFlags[name] = map[string]*string{}
+		for flagName, usage := range definition.Flags {
+			providerFlags[name][flagName] = fs.String(name+"."+flagName, "", usage)
+		}
+	}
+}
+
+// activeProviders returns the flag values of every provider that had at least
+// one of its flags set, keyed by provider name. The flags of every active
+// provider are validated before returning so all problems are reported before
+// any provider is contacted.
+func activeProviders() (map[string]map[string]string, error) {
+	active := map[string]map[string]string{}
+	for name, flags := range providerFlags {
+		values := map[string]string{}
+		for flagName, value := range flags {
+			if *value != "" {
+				values[flagName] = *value
+			}
+		}
+
+		if len(values) != 0 {
+			active[name] = values
+		}
+	}
+
+	var err error
+	for _, name := range sortedProviderNames(active) {
+		definition, _ := provider.Lookup(name)
+		validationErr := definition.Validate(active[name])
+		switch {
+		case validationErr == nil:
+		case err == nil:
+			err = validationErr
+		default:
+			err = fmt.Errorf("%w; %v", err, validationErr)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return active, nil
+}
+
+// sortedProviderNames returns the names of the providers in active in a stable
+// order.
+func sortedProviderNames(active map[string]map[string]string) []string {
+	names := make([]string, 0, len(active))
+	for name := range active {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/hosts"
+)
+
+// serviceName names the installed service.
+const serviceName = "dhcp-hosts-updater"
+
+// service describes how the OS service manager runs the updater.
+type service struct {
+	// Exe is the absolute path of the updater executable.
+	Exe string
+	// Args are the flags the updater was given, without the service
+	// command.
+	Args []string
+	// Dir is the working directory, so that relative paths in Args keep
+	// pointing at the same files.
+	Dir string
+	// Env holds the environment variables the updater reads, if set.
+	Env map[string]string
+	// User is the user the updater runs as, root if empty.
+	User string
+	// Daemon is set when Args run the updater as a daemon, which the
+	// service manager keeps running, rather than once every Interval.
+	Daemon   bool
+	Interval time.Duration
+}
+
+// EnvNames returns the names in Env, sorted.
+func (s *service) EnvNames() []string {
+	names := make([]string, 0, len(s.Env))
+	for name := range s.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// runService runs the service command, whose only subcommand, install,
+// installs the updater as a service run with the flags given before the
+// command.
+func runService(args []string) int {
+	if len(args) != 1 || args[0] != "install" {
+		flag.Usage()
+		return exitUsage
+	}
+
+	active, err := activeProviders()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitCodeFor(err)
+	}
+	if len(active) == 0 {
+		fmt.Fprintln(os.Stderr, "service install requires the flags of at least one provider")
+		return exitUsage
+	}
+
+	if *interval == 0 && *serviceInterval <= 0 {
+		fmt.Fprintln(os.Stderr, "-service-interval must be positive")
+		return exitUsage
+	}
+
+	// The write helper only keeps root away from the provider credentials
+	// when the service itself does not run as root.
+	if *writeHelper != "" && *serviceUser == "" {
+		fmt.Fprintln(os.Stderr, "-write-helper requires -service-user, or the service runs as root")
+		return exitUsage
+	}
+
+	s, err := newService()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not install service: %v\n", err)
+		return exitUsage
+	}
+
+	path, err := installService(s)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not install service: %v\n", err)
+		return exitUsage
+	}
+
+	fmt.Printf("installed and started %s\n", path)
+	return exitOK
+}
+
+// newService describes the service running this executable with the flags it
+// was given.
+func newService() (*service, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	exe, err = filepath.EvalSymlinks(exe)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &service{
+		Exe:      exe,
+		Args:     os.Args[1 : len(os.Args)-flag.NArg()],
+		Dir:      dir,
+		Env:      map[string]string{},
+		User:     *serviceUser,
+		Daemon:   *interval > 0,
+		Interval: *serviceInterval,
+	}
+	for _, name := range []string{hosts.PathEnv, pluginDirEnv} {
+		if value, ok := os.LookupEnv(name); ok {
+			s.Env[name] = value
+		}
+	}
+
+	return s, nil
+}
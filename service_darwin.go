@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"text/template"
+)
+
+// launchdLabel is the label of the launchd job.
+const launchdLabel = "com.github.grounded042." + serviceName
+
+var launchdPlist = template.Must(template.New("plist").Funcs(template.FuncMap{"xml": xmlEscape}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>{{xml .Label}}</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>{{xml .Exe}}</string>
+{{- range .Args}}
+		<string>{{xml .}}</string>
+{{- end}}
+	</array>
+	<key>WorkingDirectory</key>
+	<string>{{xml .Dir}}</string>
+{{- if .User}}
+	<key>UserName</key>
+	<string>{{xml .User}}</string>
+{{- end}}
+{{- if .Env}}
+	<key>EnvironmentVariables</key>
+	<dict>
+{{- range .EnvNames}}
+		<key>{{xml .}}</key>
+		<string>{{xml (index $.Env .)}}</string>
+{{- end}}
+	</dict>
+{{- end}}
+	<key>RunAtLoad</key>
+	<true/>
+{{- if .Daemon}}
+	<key>KeepAlive</key>
+	<true/>
+{{- else}}
+	<key>StartInterval</key>
+	<integer>{{.Interval.Seconds | printf "%.0f"}}</integer>
+{{- end}}
+	<key>StandardOutPath</key>
+	<string>/var/log/{{.Name}}.log</string>
+	<key>StandardErrorPath</key>
+	<string>/var/log/{{.Name}}.log</string>
+</dict>
+</plist>
+`))
+
+// installService writes a launchd daemon plist for s and loads it, replacing
+// a job loaded before. The plist is only readable by root as the flags may
+// hold passwords.
+func installService(s *service) (string, error) {
+	var plist bytes.Buffer
+	err := launchdPlist.Execute(&plist, struct {
+		*service
+		Label string
+		Name  string
+	}{s, launchdLabel, serviceName})
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join("/Library/LaunchDaemons", launchdLabel+".plist")
+	err = ioutil.WriteFile(path, plist.Bytes(), 0600)
+	if err != nil {
+		return "", err
+	}
+
+	// bootout fails if the job is not loaded, which is fine.
+	exec.Command("launchctl", "bootout", "system/"+launchdLabel).Run()
+
+	out, err := exec.Command("launchctl", "bootstrap", "system", path).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("could not load %s: %v: %s", path, err, bytes.TrimSpace(out))
+	}
+
+	return path, nil
+}
+
+func xmlEscape(s string) (string, error) {
+	var b bytes.Buffer
+	err := xml.EscapeText(&b, []byte(s))
+
+	return b.String(), err
+}
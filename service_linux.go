@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// systemdDir is where the units are installed.
+const systemdDir = "/etc/systemd/system"
+
+// systemdService is the service unit. The updater exits with exitChanged
+// after writing changes, which systemd must not take for a failure.
+var systemdService = template.Must(template.New("service").Funcs(template.FuncMap{"arg": systemdArg, "quote": systemdQuote, "escape": systemdEscape}).Parse(`[Unit]
+Description=Update the hosts file with the hostnames of DHCP clients
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+{{- if .Daemon}}
+Type=simple
+Restart=on-failure
+RestartSec=30s
+{{- else}}
+Type=oneshot
+{{- end}}
+ExecStart={{arg .Exe}}{{range .Args}} {{arg .}}{{end}}
+WorkingDirectory={{escape .Dir}}
+{{- if .User}}
+User={{escape .User}}
+{{- end}}
+{{- range .EnvNames}}
+Environment={{quote (printf "%s=%s" . (index $.Env .))}}
+{{- end}}
+SuccessExitStatus={{.ExitChanged}}
+{{- if .Daemon}}
+
+[Install]
+WantedBy=multi-user.target
+{{- end}}
+`))
+
+var systemdTimer = template.Must(template.New("timer").Parse(`[Unit]
+Description=Run {{.Name}} every {{.Interval}}
+
+[Timer]
+OnBootSec=1min
+OnUnitActiveSec={{.Interval.Seconds | printf "%.0f"}}s
+
+[Install]
+WantedBy=timers.target
+`))
+
+// installService writes a systemd service unit for s and, unless s runs as a
+// daemon, a timer starting it every interval, then enables and starts the
+// unit the service manager runs. Units installed before are stopped and
+// replaced. The units are only readable by root as the flags may hold
+// passwords.
+func installService(s *service) (string, error) {
+	data := struct {
+		*service
+		Name        string
+		ExitChanged int
+	}{s, serviceName, exitChanged}
+
+	servicePath := filepath.Join(systemdDir, serviceName+".service")
+	timerPath := filepath.Join(systemdDir, serviceName+".timer")
+
+	// disable fails for units that are not installed, which is fine.
+	exec.Command("systemctl", "disable", "--now", serviceName+".timer", serviceName+".service").Run()
+
+	err := writeUnit(servicePath, systemdService, data)
+	if err != nil {
+		return "", err
+	}
+
+	enable := servicePath
+	if s.Daemon {
+		err = os.Remove(timerPath)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	} else {
+		err = writeUnit(timerPath, systemdTimer, data)
+		if err != nil {
+			return "", err
+		}
+		enable = timerPath
+	}
+
+	err = systemctl("daemon-reload")
+	if err != nil {
+		return "", err
+	}
+
+	err = systemctl("enable", "--now", filepath.Base(enable))
+	if err != nil {
+		return "", err
+	}
+
+	return enable, nil
+}
+
+func writeUnit(path string, tmpl *template.Template, data interface{}) error {
+	var unit bytes.Buffer
+	err := tmpl.Execute(&unit, data)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, unit.Bytes(), 0600)
+}
+
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s: %v: %s", strings.Join(args, " "), err, bytes.TrimSpace(out))
+	}
+
+	return nil
+}
+
+// systemdEscape escapes the specifiers systemd expands in unit file settings.
+func systemdEscape(s string) string {
+	return strings.Replace(s, "%", "%%", -1)
+}
+
+// systemdArg quotes s as a single argument of a command line, escaping the
+// variable references systemd would otherwise expand.
+func systemdArg(s string) string {
+	return systemdQuote(strings.Replace(s, "$", "$$", -1))
+}
+
+// systemdQuote quotes s as a single word of a unit file setting.
+func systemdQuote(s string) string {
+	s = systemdEscape(s)
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `"`, `\"`, -1)
+
+	return `"` + s + `"`
+}
@@ -0,0 +1,13 @@
+//go:build !darwin && !linux
+// +build !darwin,!linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func installService(s *service) (string, error) {
+	return "", fmt.Errorf("not supported on %s", runtime.GOOS)
+}
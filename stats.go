@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/provider"
+)
+
+// hostCounts tallies the hosts reported by a provider, or by one of its
+// networks.
+type hostCounts struct {
+	total, static, dynamic, named, unnamed int
+}
+
+func (c *hostCounts) add(h provider.Host) {
+	c.total++
+	if h.Static {
+		c.static++
+	} else {
+		c.dynamic++
+	}
+	if strings.TrimSpace(h.Name) != "" {
+		c.named++
+	} else {
+		c.unnamed++
+	}
+}
+
+func (c hostCounts) String() string {
+	return fmt.Sprintf("hosts=%d static=%d dynamic=%d named=%d unnamed=%d", c.total, c.static, c.dynamic, c.named, c.unnamed)
+}
+
+// runStats fetches the hosts of each active provider, before any validation,
+// and prints how many there are in total and per network, split into static
+// and dynamic ones and those with and without hostnames, without touching
+// the hosts file.
+func runStats(active map[string]map[string]string, opts []provider.Option) int {
+	code := exitOK
+	for _, name := range sortedProviderNames(active) {
+		p, err := provider.New(name, active[name], opts...)
+		if err != nil {
+			fmt.Printf("%s: error=%q\n", name, err)
+			code = exitProviderError
+			continue
+		}
+
+		hosts, err := p.GetHosts(context.Background())
+		if err != nil {
+			fmt.Printf("%s: error=%q\n", name, err)
+			code = exitProviderError
+			continue
+		}
+
+		var total hostCounts
+		networks := map[string]*hostCounts{}
+		for _, h := range hosts {
+			total.add(h)
+
+			network := h.Network
+			if network == "" {
+				network = "unknown"
+			}
+			if networks[network] == nil {
+				networks[network] = &hostCounts{}
+			}
+			networks[network].add(h)
+		}
+
+		fmt.Printf("%s: %v\n", name, total)
+
+		names := make([]string, 0, len(networks))
+		for network := range networks {
+			names = append(names, network)
+		}
+		sort.Strings(names)
+		for _, network := range names {
+			fmt.Printf("%s: network=%q %v\n", name, network, networks[network])
+		}
+	}
+
+	return code
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/host"
+)
+
+// runSummary describes the outcome of a single update run.
+type runSummary struct {
+	fetched   map[string]int
+	failed    []string
+	added     int
+	updated   int
+	removed   int
+	unchanged int
+	duration  time.Duration
+}
+
+// newRunSummary tallies the hosts fetched from each provider, the providers
+// that failed, and the changes made for them.
+func newRunSummary(fetched map[string][]host.Host, failed []string, changes host.ChangeSet, duration time.Duration) runSummary {
+	s := runSummary{
+		fetched:  map[string]int{},
+		failed:   failed,
+		duration: duration,
+	}
+
+	for provider, hosts := range fetched {
+		s.fetched[provider] = len(hosts)
+	}
+
+	s.added = changes.Count(host.ActionAdd)
+	s.updated = changes.Count(host.ActionUpdate)
+	s.removed = changes.Count(host.ActionRemove)
+
+	s.unchanged = len(changes.Unchanged)
+
+	return s
+}
+
+func (s runSummary) String() string {
+	providers := make([]string, 0, len(s.fetched))
+	for provider := range s.fetched {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+
+	counts := make([]string, 0, len(providers))
+	for _, provider := range providers {
+		counts = append(counts, fmt.Sprintf("%d hosts from %s", s.fetched[provider], provider))
+	}
+
+	if len(s.failed) > 0 {
+		counts = append(counts, "failed "+strings.Join(s.failed, ", "))
+	}
+
+	return fmt.Sprintf("fetched %s; %d added, %d updated, %d removed, %d unchanged in %v",
+		strings.Join(counts, ", "), s.added, s.updated, s.removed, s.unchanged, s.duration.Round(time.Millisecond))
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/host"
+	"github.com/grounded042/dhcp-hosts-updater/pkg/notify"
+	"github.com/grounded042/dhcp-hosts-updater/pkg/provider"
+	"github.com/grounded042/dhcp-hosts-updater/pkg/state"
+)
+
+// syncer updates the hosts file from the active providers. It keeps the
+// providers it connected to between syncs, so that a daemon logs in once and
+// only reconnects to providers that failed to connect or whose session was
+// rejected.
+type syncer struct {
+	active       map[string]map[string]string
+	providerOpts []provider.Option
+	retry        host.Retry
+	// sink is the system hosts file, the primary sink of the updater.
+	sink      *host.HostsFile
+	updater   *host.Updater
+	notifiers []notify.Notifier
+	// state, when set, remembers the devices seen so that new ones can be
+	// announced, and the history of recent syncs. It is saved to the
+	// -state-file after every sync.
+	state *state.State
+	// metrics, when set, is updated after every sync.
+	metrics *metrics
+	// inventory, when set, is given the hosts applied by every sync and
+	// the changes it made.
+	inventory *inventory
+	// desired holds the hosts last applied to the hosts file, after the
+	// updater's transformers, once trackDesired was called.
+	desired []host.Host
+	pending []host.Host
+
+	providers map[string]provider.HostsProvider
+	// limiters space out the requests to each provider with -min-interval,
+	// kept across reconnects.
+	limiters map[string]*provider.RateLimiter
+}
+
+// connect creates the providers that are not connected yet, returning the
+// errors of those that failed. A usage error is returned as err instead since
+// no later sync can fix it.
+func (s *syncer) connect(ctx context.Context) ([]*provider.Error, error) {
+	if s.providers == nil {
+		s.providers = map[string]provider.HostsProvider{}
+	}
+
+	var failures []*provider.Error
+	for _, name := range sortedProviderNames(s.active) {
+		if _, ok := s.providers[name]; ok {
+			continue
+		}
+
+		var p provider.HostsProvider
+		err := s.retry.Do(ctx, func(ctx context.Context) error {
+			opts := append([]provider.Option{provider.WithContext(ctx)}, s.providerOpts...)
+			if *minInterval > 0 {
+				opts = append(opts, provider.WithTransport(s.limiter(name).Transport))
+			}
+
+			var err error
+			p, err = provider.New(name, s.active[name], opts...)
+			return err
+		})
+		if err != nil {
+			errorLog.Printf("could not connect to provider %v", err)
+			if exitCodeFor(err) == exitUsage {
+				return nil, err
+			}
+
+			var providerErr *provider.Error
+			if !errors.As(err, &providerErr) {
+				providerErr = &provider.Error{Provider: name, Err: err}
+			}
+			failures = append(failures, providerErr)
+			s.metrics.providerError(name)
+			s.inventory.providerFailed(name, err)
+			continue
+		}
+
+		s.providers[name] = p
+	}
+
+	return failures, nil
+}
+
+// limiter returns the rate limiter of the provider name, creating it on first
+// use.
+func (s *syncer) limiter(name string) *provider.RateLimiter {
+	if s.limiters == nil {
+		s.limiters = map[string]*provider.RateLimiter{}
+	}
+	if _, ok := s.limiters[name]; !ok {
+		s.limiters[name] = provider.NewRateLimiter(*minInterval)
+	}
+
+	return s.limiters[name]
+}
+
+// sync fetches the hosts of every provider and applies them to the hosts
+// file, printing the outcome, and returns the exit code describing it.
+func (s *syncer) sync(ctx context.Context) (code int) {
+	start := time.Now()
+
+	if *pingURL != "" && !*dryRun {
+		defer func() {
+			err := ping(context.Background(), *pingURL, code == exitOK || code == exitChanged)
+			if err != nil {
+				errorLog.Printf("could not ping %s: %v", *pingURL, err)
+			}
+		}()
+	}
+
+	run := state.Run{Start: start}
+	if s.state != nil {
+		defer func() {
+			s.recordRun(run, code)
+		}()
+	}
+
+	// A provider that fails is reported and left out rather than aborting
+	// the run, as long as another provider succeeds.
+	failures, err := s.connect(ctx)
+	if err != nil {
+		run.Errors = append(run.Errors, err.Error())
+		return exitUsage
+	}
+
+	fetched, err := s.updater.Fetch(ctx, s.providers)
+	var fetchErr *host.FetchError
+	if errors.As(err, &fetchErr) {
+		for _, err := range fetchErr.Errors {
+			errorLog.Printf("could not get hosts from provider %v", err)
+			failures = append(failures, err)
+
+			// Log in again next time in case the session expired.
+			if errors.Is(err, provider.ErrAuthFailed) {
+				delete(s.providers, err.Provider)
+			}
+		}
+	}
+	s.metrics.fetched(fetched)
+
+	for _, err := range failures {
+		run.Errors = append(run.Errors, err.Error())
+	}
+	run.Fetched = map[string]int{}
+	for name, hosts := range fetched {
+		run.Fetched[name] = len(hosts)
+	}
+
+	if len(fetched) == 0 {
+		return exitCodeFor(failures[len(failures)-1])
+	}
+
+	failed := make([]string, 0, len(failures))
+	for _, err := range failures {
+		failed = append(failed, err.Provider)
+	}
+	sort.Strings(failed)
+
+	var hosts []host.Host
+	for _, name := range sortedProviderNames(s.active) {
+		hosts = append(hosts, fetched[name]...)
+	}
+
+	// Failing to write an extra hosts file does not undo the changes made to
+	// the system one, which are still reported.
+	changes, err := s.updater.Update(ctx, hosts)
+	var sinkErr *host.SinkError
+	sinkFailed := errors.As(err, &sinkErr) && sinkErr.PrimaryApplied
+	if sinkFailed {
+		for _, err := range sinkErr.Errors {
+			errorLog.Printf("could not update hosts file %v", err)
+			run.Errors = append(run.Errors, err.Error())
+		}
+	} else if err != nil {
+		errorLog.Printf("could not update hosts file %s: %v", s.sink.Path, err)
+		run.Errors = append(run.Errors, err.Error())
+		return exitCodeFor(err)
+	}
+
+	run.Added = changes.Count(host.ActionAdd)
+	run.Updated = changes.Count(host.ActionUpdate)
+	run.Removed = changes.Count(host.ActionRemove)
+
+	s.desired = s.pending
+	s.metrics.synced(changes, len(failed) == 0 && !sinkFailed)
+	if !*dryRun {
+		s.inventory.synced(s.desired, changes, time.Now())
+	}
+
+	newDevices := s.observeDevices(hosts)
+	s.notify(ctx, changes, newDevices)
+
+	if *quiet && changes.Empty() && len(failed) == 0 && !sinkFailed && len(newDevices) == 0 {
+		return exitOK
+	}
+
+	if *showDiff || *dryRun {
+		printDiff(os.Stdout, changes, !*noColor && isTerminal(os.Stdout))
+	}
+
+	if *outputEvents == "json" {
+		err = writeEvents(os.Stdout, changes, newDevices)
+		if err != nil {
+			errorLog.Printf("could not write events: %v", err)
+		}
+	}
+
+	summary := newRunSummary(fetched, failed, changes, time.Since(start))
+	if *dryRun {
+		log.Printf("dry run, %s was not written: %s", s.sink.Path, summary)
+	} else {
+		log.Print(summary)
+	}
+
+	switch {
+	case len(failed) > 0, sinkFailed:
+		return exitPartialFailure
+	case changes.Empty():
+		return exitOK
+	default:
+		return exitChanged
+	}
+}
+
+// observeDevices records the devices among hosts in the state, returning the
+// ones never seen before. While the state holds no devices they are learned
+// without being returned, so that the first run does not announce every
+// device on the network.
+func (s *syncer) observeDevices(hosts []host.Host) []state.Device {
+	if s.state == nil {
+		return nil
+	}
+
+	learning := len(s.state.Devices) == 0
+	seen := s.state.ObserveDevices(hosts, time.Now())
+
+	if learning {
+		if !*quiet {
+			log.Printf("learned %d devices, devices seen after this will be announced", len(seen))
+		}
+		return nil
+	}
+
+	for _, d := range seen {
+		log.Printf("new device %s %q at %s", d.MAC, d.Hostname, d.IP)
+	}
+
+	return seen
+}
+
+// recordRun adds run, which ended with code, to the history in the state and
+// saves the state unless this is a dry run.
+func (s *syncer) recordRun(run state.Run, code int) {
+	run.Duration = time.Since(run.Start)
+	run.ExitCode = code
+	s.state.RecordRun(run, *historySize)
+
+	if *dryRun {
+		return
+	}
+
+	err := s.state.Save(*stateFile)
+	if err != nil {
+		errorLog.Printf("could not save state file: %v", err)
+	}
+}
+
+// notify sends the changes and new devices to every notifier, unless there is
+// nothing to report or this is a dry run.
+func (s *syncer) notify(ctx context.Context, changes host.ChangeSet, newDevices []state.Device) {
+	if *dryRun {
+		return
+	}
+
+	payload := notify.NewPayload(changes)
+	for _, d := range newDevices {
+		payload.NewDevices = append(payload.NewDevices, notify.Host{Hostname: d.Hostname, IP: d.IP, MAC: d.MAC})
+	}
+	if payload.Empty() {
+		return
+	}
+
+	for _, n := range s.notifiers {
+		err := n.Notify(ctx, payload)
+		if err != nil {
+			errorLog.Printf("notification failed: %v", err)
+		}
+	}
+}
+
+// trackDesired makes every sync remember the hosts it applied in desired, so
+// that checkDrift can tell whether the hosts file still holds them and the
+// inventory can serve them.
+func (s *syncer) trackDesired() {
+	s.updater.OnBeforeApply = func(ctx context.Context, hosts []host.Host) error {
+		s.pending = hosts
+		return nil
+	}
+}
+
+// checkDrift warns if the hosts file no longer holds the hosts last applied
+// to it, meaning something else edited it since. The entries are left as they
+// are until the next sync puts them back.
+func (s *syncer) checkDrift(ctx context.Context) {
+	// A dry run never wrote the hosts, so they would always be missing.
+	if s.desired == nil || *dryRun {
+		return
+	}
+
+	drift, err := s.sink.Check(ctx, s.desired)
+	if err != nil {
+		errorLog.Printf("could not check hosts file %s for drift: %v", s.sink.Path, err)
+		return
+	}
+
+	s.metrics.driftChecked(drift)
+	if drift.Empty() {
+		return
+	}
+
+	for _, change := range drift.Changes {
+		switch change.Action {
+		case host.ActionAdd:
+			warnLog.Printf("hosts file drift: %s %s is missing", change.Host.Name, change.Host.IP)
+		case host.ActionUpdate:
+			warnLog.Printf("hosts file drift: %s points at %s instead of %s", change.Host.Name, change.OldIP, change.Host.IP)
+		case host.ActionRemove:
+			warnLog.Printf("hosts file drift: %s %s was added for a managed IP", change.Host.Name, change.Host.IP)
+		}
+	}
+
+	if *outputEvents == "json" {
+		err = writeDriftEvents(os.Stdout, drift)
+		if err != nil {
+			errorLog.Printf("could not write events: %v", err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/grounded042/dhcp-hosts-updater/pkg/host"
+)
+
+// fakeEdgeOS is an EdgeOS router accepting one session at a time. Expiring
+// the session makes the API serve the login page, as the router does.
+type fakeEdgeOS struct {
+	mu      sync.Mutex
+	session string
+	logins  int
+}
+
+func (r *fakeEdgeOS) expire() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.session = ""
+}
+
+func (r *fakeEdgeOS) loginCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.logins
+}
+
+func (r *fakeEdgeOS) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if req.Method == http.MethodPost && req.URL.Path == "/" {
+		r.logins++
+		r.session = fmt.Sprintf("session-%d", r.logins)
+		http.SetCookie(w, &http.Cookie{Name: "PHPSESSID", Value: r.session, Path: "/"})
+		http.Redirect(w, req, "/dashboard", http.StatusSeeOther)
+		return
+	}
+
+	cookie, err := req.Cookie("PHPSESSID")
+	if req.URL.Path == "/dashboard" || err != nil || r.session == "" || cookie.Value != r.session {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, "<html><body>Login</body></html>")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	switch req.URL.Path {
+	case "/api/edge/data.json":
+		fmt.Fprint(w, `{"success": "1", "output": {"dhcp-server-leases": {"LAN": {"10.0.0.20": {"client-hostname": "laptop"}}}}}`)
+	case "/api/edge/get.json":
+		fmt.Fprint(w, `{"GET": {}, "success": true}`)
+	default:
+		http.NotFound(w, req)
+	}
+}
+
+func TestSyncReconnectsAfterSessionExpired(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "hosts")
+	err = ioutil.WriteFile(path, []byte("127.0.0.1 localhost\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := &fakeEdgeOS{}
+	server := httptest.NewTLSServer(router)
+	defer server.Close()
+
+	sink := &host.HostsFile{Path: path}
+	s := &syncer{
+		active: map[string]map[string]string{
+			"edgeos": {"address": server.Listener.Addr().String(), "username": "ubnt", "password": "secret"},
+		},
+		sink:    sink,
+		updater: host.NewUpdater(sink),
+	}
+
+	ctx := context.Background()
+	if code := s.sync(ctx); code != exitChanged {
+		t.Fatalf("first sync = %d, want %d", code, exitChanged)
+	}
+
+	router.expire()
+	if code := s.sync(ctx); code != exitProviderError {
+		t.Errorf("sync with an expired session = %d, want %d", code, exitProviderError)
+	}
+	if n := router.loginCount(); n != 1 {
+		t.Errorf("logged in %d times before the session was found expired, want 1", n)
+	}
+
+	if code := s.sync(ctx); code != exitOK {
+		t.Errorf("sync after the session expired = %d, want %d", code, exitOK)
+	}
+	if n := router.loginCount(); n != 2 {
+		t.Errorf("logged in %d times, want 2 as the provider reconnects", n)
+	}
+}